@@ -2,51 +2,137 @@ package idex
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 )
 
+// Doer sends an HTTP request and returns its response, satisfied by *http.Client
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
 // API for requests
 type API struct {
 	URL string
+	// Client sends the requests, http.DefaultClient when nil
+	Client Doer
+	// Retry transient failures of read-only requests, no retries when nil
+	Retry *RetryPolicy
+	// Limiter throttles every request made by the API, unlimited when nil
+	Limiter *RateLimiter
+	// Signer signs orders, trades, cancels and withdrawals for its address
+	Signer Signer
+	// Nonces allocates the nonces of signed requests, fetched for each request when nil
+	Nonces *NonceManager
+
+	mu       sync.Mutex
+	tokens   *TokenRegistry
+	markets  *MarketResolver
+	contract string
+}
+
+func (a *API) client() Doer {
+	if a.Client == nil {
+		return http.DefaultClient
+	}
+	return a.Client
 }
 
 // Post returns the result of a POST to the endpoint with the payload
 func (a *API) Post(endpoint, payload string) ([]byte, error) {
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", a.URL, endpoint), bytes.NewBuffer([]byte(payload)))
+	return a.PostContext(context.Background(), endpoint, payload)
+}
+
+// PostContext returns the result of a POST to the endpoint with the payload,
+// aborting the request when ctx is done. Error responses are returned as *APIError
+func (a *API) PostContext(ctx context.Context, endpoint, payload string) ([]byte, error) {
+	if a.Retry == nil || !retryable(endpoint) {
+		return a.post(ctx, endpoint, payload)
+	}
+
+	for attempt := 1; ; attempt++ {
+		body, err := a.post(ctx, endpoint, payload)
+		if err == nil || attempt >= a.Retry.MaxAttempts || !shouldRetry(ctx, err) {
+			return body, err
+		}
+
+		d := a.Retry.delay(attempt, err)
+		if a.Retry.OnRetry != nil {
+			a.Retry.OnRetry(RetryEvent{Endpoint: endpoint, Attempt: attempt, Delay: d, Err: err})
+		}
+		if err := sleep(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// post makes a single attempt at the request
+func (a *API) post(ctx context.Context, endpoint, payload string) ([]byte, error) {
+	if a.Limiter != nil {
+		if err := a.Limiter.Wait(ctx, a.Limiter.Weight(endpoint)); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s", a.URL, endpoint), bytes.NewBuffer([]byte(payload)))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := a.client().Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := apiError(resp.StatusCode, endpoint, payload, body); err != nil {
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		return nil, err
+	}
+
+	return body, nil
 }
 
 // Ticker for the market
 func (a *API) Ticker(market string) (t *Ticker, err error) {
+	return a.TickerContext(context.Background(), market)
+}
+
+// TickerContext is like Ticker but uses ctx for the request
+func (a *API) TickerContext(ctx context.Context, market string) (t *Ticker, err error) {
 	if market == "" {
 		err = fmt.Errorf("market is required")
 		return
 	}
 
-	payload := fmt.Sprintf(`{"market":"%s"}`, market)
+	payload, err := encode(&marketPayload{Market: market})
+	if err != nil {
+		return
+	}
 
-	body, err := a.Post("returnTicker", payload)
+	body, err := a.PostContext(ctx, "returnTicker", payload)
 	if err != nil {
 		return
 	}
 
 	if strings.TrimSpace(string(body)) == "{}" {
-		err = fmt.Errorf("market %v not found", market)
+		err = &APIError{
+			StatusCode: http.StatusOK,
+			Endpoint:   "returnTicker",
+			Payload:    payload,
+			Message:    fmt.Sprintf("market %v not found", market),
+		}
 		return
 	}
 
@@ -56,7 +142,12 @@ func (a *API) Ticker(market string) (t *Ticker, err error) {
 
 // Tickers for all markets
 func (a *API) Tickers() (t map[string]*Ticker, err error) {
-	body, err := a.Post("returnTicker", "")
+	return a.TickersContext(context.Background())
+}
+
+// TickersContext is like Tickers but uses ctx for the request
+func (a *API) TickersContext(ctx context.Context) (t map[string]*Ticker, err error) {
+	body, err := a.PostContext(ctx, "returnTicker", "")
 	if err != nil {
 		return
 	}
@@ -67,7 +158,12 @@ func (a *API) Tickers() (t map[string]*Ticker, err error) {
 
 // Volume24 returns 24-hour volume for all markets
 func (a *API) Volume24() (v *Volume, err error) {
-	body, err := a.Post("return24Volume", "")
+	return a.Volume24Context(context.Background())
+}
+
+// Volume24Context is like Volume24 but uses ctx for the request
+func (a *API) Volume24Context(ctx context.Context) (v *Volume, err error) {
+	body, err := a.PostContext(ctx, "return24Volume", "")
 	if err != nil {
 		return
 	}
@@ -79,14 +175,22 @@ func (a *API) Volume24() (v *Volume, err error) {
 
 // OrderBook for a market
 func (a *API) OrderBook(market string) (ob *OrderBook, err error) {
+	return a.OrderBookContext(context.Background(), market)
+}
+
+// OrderBookContext is like OrderBook but uses ctx for the request
+func (a *API) OrderBookContext(ctx context.Context, market string) (ob *OrderBook, err error) {
 	if market == "" {
 		err = fmt.Errorf("market is required")
 		return
 	}
 
-	payload := fmt.Sprintf(`{"market":"%s"}`, market)
+	payload, err := encode(&marketPayload{Market: market})
+	if err != nil {
+		return
+	}
 
-	body, err := a.Post("returnOrderBook", payload)
+	body, err := a.PostContext(ctx, "returnOrderBook", payload)
 	if err != nil {
 		return
 	}
@@ -97,14 +201,22 @@ func (a *API) OrderBook(market string) (ob *OrderBook, err error) {
 
 // OpenOrders all open orders for market and/or user address
 func (a *API) OpenOrders(market, address string) (os []*OpenOrder, err error) {
+	return a.OpenOrdersContext(context.Background(), market, address)
+}
+
+// OpenOrdersContext is like OpenOrders but uses ctx for the request
+func (a *API) OpenOrdersContext(ctx context.Context, market, address string) (os []*OpenOrder, err error) {
 	if market == "" && address == "" {
 		err = fmt.Errorf("market or address is required")
 		return
 	}
 
-	payload := fmt.Sprintf(`{"market":"%s", "address":"%s"}`, market, address)
+	payload, err := encode(&openOrdersPayload{Market: market, Address: address})
+	if err != nil {
+		return
+	}
 
-	body, err := a.Post("returnOpenOrders", payload)
+	body, err := a.PostContext(ctx, "returnOpenOrders", payload)
 	if err != nil {
 		return
 	}
@@ -116,19 +228,22 @@ func (a *API) OpenOrders(market, address string) (os []*OpenOrder, err error) {
 // TradeHistoryMarket trade history for a market, filterable by user and timestamps
 // API limited to 200 trades
 func (a *API) TradeHistoryMarket(market, address string, start, end int) (ts []*Trade, err error) {
+	return a.TradeHistoryMarketContext(context.Background(), market, address, start, end)
+}
+
+// TradeHistoryMarketContext is like TradeHistoryMarket but uses ctx for the request
+func (a *API) TradeHistoryMarketContext(ctx context.Context, market, address string, start, end int) (ts []*Trade, err error) {
 	if market == "" {
 		err = fmt.Errorf("market is required")
 		return
 	}
 
-	var payload string
-	if address == "" {
-		payload = fmt.Sprintf(`{"market":"%s", "start":%d, "end":%d}`, market, start, end)
-	} else {
-		payload = fmt.Sprintf(`{"market":"%s", "address":"%s", "start":%d, "end":%d}`, market, address, start, end)
+	payload, err := encode(&tradeHistoryPayload{Market: market, Address: address, Start: start, End: end})
+	if err != nil {
+		return
 	}
 
-	body, err := a.Post("returnTradeHistory", payload)
+	body, err := a.PostContext(ctx, "returnTradeHistory", payload)
 	if err != nil {
 		return
 	}
@@ -140,14 +255,22 @@ func (a *API) TradeHistoryMarket(market, address string, start, end int) (ts []*
 // TradeHistoryUser trade history for a user across all markets, filterable by timestamps
 // API limited to 200 trades
 func (a *API) TradeHistoryUser(address string, start, end int) (ts map[string][]*Trade, err error) {
+	return a.TradeHistoryUserContext(context.Background(), address, start, end)
+}
+
+// TradeHistoryUserContext is like TradeHistoryUser but uses ctx for the request
+func (a *API) TradeHistoryUserContext(ctx context.Context, address string, start, end int) (ts map[string][]*Trade, err error) {
 	if address == "" {
 		err = fmt.Errorf("address is required")
 		return
 	}
 
-	payload := fmt.Sprintf(`{"address":"%s", "start":%d, "end":%d}`, address, start, end)
+	payload, err := encode(&tradeHistoryPayload{Address: address, Start: start, End: end})
+	if err != nil {
+		return
+	}
 
-	body, err := a.Post("returnTradeHistory", payload)
+	body, err := a.PostContext(ctx, "returnTradeHistory", payload)
 	if err != nil {
 		return
 	}
@@ -158,7 +281,12 @@ func (a *API) TradeHistoryUser(address string, start, end int) (ts map[string][]
 
 // Currencies returns all supported currencies
 func (a *API) Currencies() (cs map[string]*Currency, err error) {
-	body, err := a.Post("returnCurrencies", "")
+	return a.CurrenciesContext(context.Background())
+}
+
+// CurrenciesContext is like Currencies but uses ctx for the request
+func (a *API) CurrenciesContext(ctx context.Context) (cs map[string]*Currency, err error) {
+	body, err := a.PostContext(ctx, "returnCurrencies", "")
 	if err != nil {
 		return
 	}
@@ -168,15 +296,23 @@ func (a *API) Currencies() (cs map[string]*Currency, err error) {
 }
 
 // Balances returns available balances
-func (a *API) Balances(address string) (bs map[string]string, err error) {
+func (a *API) Balances(address string) (bs map[string]Decimal, err error) {
+	return a.BalancesContext(context.Background(), address)
+}
+
+// BalancesContext is like Balances but uses ctx for the request
+func (a *API) BalancesContext(ctx context.Context, address string) (bs map[string]Decimal, err error) {
 	if address == "" {
 		err = fmt.Errorf("address is required")
 		return
 	}
 
-	payload := fmt.Sprintf(`{"address":"%s"}`, address)
+	payload, err := encode(&addressPayload{Address: address})
+	if err != nil {
+		return
+	}
 
-	body, err := a.Post("returnBalances", payload)
+	body, err := a.PostContext(ctx, "returnBalances", payload)
 	if err != nil {
 		return
 	}
@@ -187,14 +323,22 @@ func (a *API) Balances(address string) (bs map[string]string, err error) {
 
 // CompleteBalances returns available balances with balance in orders
 func (a *API) CompleteBalances(address string) (bs map[string]*Balance, err error) {
+	return a.CompleteBalancesContext(context.Background(), address)
+}
+
+// CompleteBalancesContext is like CompleteBalances but uses ctx for the request
+func (a *API) CompleteBalancesContext(ctx context.Context, address string) (bs map[string]*Balance, err error) {
 	if address == "" {
 		err = fmt.Errorf("address is required")
 		return
 	}
 
-	payload := fmt.Sprintf(`{"address":"%s"}`, address)
+	payload, err := encode(&addressPayload{Address: address})
+	if err != nil {
+		return
+	}
 
-	body, err := a.Post("returnCompleteBalances", payload)
+	body, err := a.PostContext(ctx, "returnCompleteBalances", payload)
 	if err != nil {
 		return
 	}
@@ -205,14 +349,22 @@ func (a *API) CompleteBalances(address string) (bs map[string]*Balance, err erro
 
 // DepositsWithdrawals returns the user's deposits and withdrawals
 func (a *API) DepositsWithdrawals(address string, start, end int) (ds []*Deposit, ws []*Withdrawal, err error) {
+	return a.DepositsWithdrawalsContext(context.Background(), address, start, end)
+}
+
+// DepositsWithdrawalsContext is like DepositsWithdrawals but uses ctx for the request
+func (a *API) DepositsWithdrawalsContext(ctx context.Context, address string, start, end int) (ds []*Deposit, ws []*Withdrawal, err error) {
 	if address == "" {
 		err = fmt.Errorf("address is required")
 		return
 	}
 
-	payload := fmt.Sprintf(`{"address":"%s", "start":%d, "end":%d}`, address, start, end)
+	payload, err := encode(&depositsWithdrawalsPayload{Address: address, Start: start, End: end})
+	if err != nil {
+		return
+	}
 
-	body, err := a.Post("returnDepositsWithdrawals", payload)
+	body, err := a.PostContext(ctx, "returnDepositsWithdrawals", payload)
 	if err != nil {
 		return
 	}
@@ -234,14 +386,22 @@ func (a *API) DepositsWithdrawals(address string, start, end int) (ds []*Deposit
 
 // OrderTrades returns all trades involved in the order hash
 func (a *API) OrderTrades(hash string) (ts []*Trade, err error) {
+	return a.OrderTradesContext(context.Background(), hash)
+}
+
+// OrderTradesContext is like OrderTrades but uses ctx for the request
+func (a *API) OrderTradesContext(ctx context.Context, hash string) (ts []*Trade, err error) {
 	if hash == "" {
 		err = fmt.Errorf("hash is required")
 		return
 	}
 
-	payload := fmt.Sprintf(`{"orderHash":"%s"}`, hash)
+	payload, err := encode(&orderTradesPayload{OrderHash: hash})
+	if err != nil {
+		return
+	}
 
-	body, err := a.Post("returnOrderTrades", payload)
+	body, err := a.PostContext(ctx, "returnOrderTrades", payload)
 	if err != nil {
 		return
 	}
@@ -252,14 +412,22 @@ func (a *API) OrderTrades(hash string) (ts []*Trade, err error) {
 
 // NextNonce returns the next available nonce
 func (a *API) NextNonce(address string) (nonce int, err error) {
+	return a.NextNonceContext(context.Background(), address)
+}
+
+// NextNonceContext is like NextNonce but uses ctx for the request
+func (a *API) NextNonceContext(ctx context.Context, address string) (nonce int, err error) {
 	if address == "" {
 		err = fmt.Errorf("address is required")
 		return
 	}
 
-	payload := fmt.Sprintf(`{"address":"%s"}`, address)
+	payload, err := encode(&addressPayload{Address: address})
+	if err != nil {
+		return
+	}
 
-	body, err := a.Post("returnNextNonce", payload)
+	body, err := a.PostContext(ctx, "returnNextNonce", payload)
 	if err != nil {
 		return
 	}
@@ -279,7 +447,12 @@ func (a *API) NextNonce(address string) (nonce int, err error) {
 
 // ContractAddress returns the IDEX contract address
 func (a *API) ContractAddress() (address string, err error) {
-	body, err := a.Post("returnContractAddress", "")
+	return a.ContractAddressContext(context.Background())
+}
+
+// ContractAddressContext is like ContractAddress but uses ctx for the request
+func (a *API) ContractAddressContext(ctx context.Context) (address string, err error) {
+	body, err := a.PostContext(ctx, "returnContractAddress", "")
 	if err != nil {
 		return
 	}
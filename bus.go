@@ -0,0 +1,224 @@
+package idex
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Bus fans websocket events out to any number of subscribers, each with its
+// own buffer. Publishing never blocks: events for a subscriber whose buffer
+// is full are dropped and counted, so a slow subscriber can't stall the
+// others.
+//
+// The typed subscriptions skip events that failed verification under
+// VerifyMark, Events gets every response as it is.
+type Bus struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBus with no subscribers
+func NewBus() *Bus {
+	return &Bus{subs: map[*Subscription]struct{}{}}
+}
+
+// Subscription to a Bus
+type Subscription struct {
+	bus     *Bus
+	deliver func(sr *SocketResponse) bool
+	close   func()
+	dropped uint64
+}
+
+// Dropped is the number of events dropped because the buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe stops deliveries and closes the subscription's channel
+func (s *Subscription) Unsubscribe() {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		s.close()
+	}
+}
+
+// Run publishes the responses of c, as filled by Socket.MonitorContext, until
+// it's closed, then closes every subscription
+func (b *Bus) Run(c <-chan SocketResponse) {
+	for sr := range c {
+		b.Publish(sr)
+	}
+	b.Close()
+}
+
+// Publish sr to the subscribers interested in it
+func (b *Bus) Publish(sr SocketResponse) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		if !s.deliver(&sr) {
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Close every subscription, subscribing afterwards gets closed channels
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		delete(b.subs, s)
+		s.close()
+	}
+	b.closed = true
+}
+
+// subscribe with deliver, a non-blocking send returning false when it drops sr
+func (b *Bus) subscribe(deliver func(sr *SocketResponse) bool, close func()) *Subscription {
+	s := &Subscription{bus: b, deliver: deliver, close: close}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close()
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Events subscribes to every response, errors and connection events included
+func (b *Bus) Events(buffer int) (<-chan SocketResponse, *Subscription) {
+	c := make(chan SocketResponse, buffer)
+	s := b.subscribe(func(sr *SocketResponse) bool {
+		select {
+		case c <- *sr:
+			return true
+		default:
+			return false
+		}
+	}, func() { close(c) })
+	return c, s
+}
+
+// Trades subscribes to inserted trades
+func (b *Bus) Trades(buffer int) (<-chan *TradeInserted, *Subscription) {
+	c := make(chan *TradeInserted, buffer)
+	s := b.subscribe(func(sr *SocketResponse) bool {
+		if sr.TradeInserted == nil || sr.VerifyError != nil {
+			return true
+		}
+		select {
+		case c <- sr.TradeInserted:
+			return true
+		default:
+			return false
+		}
+	}, func() { close(c) })
+	return c, s
+}
+
+// Orders subscribes to inserted orders
+func (b *Bus) Orders(buffer int) (<-chan *OrderInserted, *Subscription) {
+	c := make(chan *OrderInserted, buffer)
+	s := b.subscribe(func(sr *SocketResponse) bool {
+		if sr.OrderInserted == nil || sr.VerifyError != nil {
+			return true
+		}
+		select {
+		case c <- sr.OrderInserted:
+			return true
+		default:
+			return false
+		}
+	}, func() { close(c) })
+	return c, s
+}
+
+// Cancels subscribes to cancelled orders
+func (b *Bus) Cancels(buffer int) (<-chan *PushCancel, *Subscription) {
+	c := make(chan *PushCancel, buffer)
+	s := b.subscribe(func(sr *SocketResponse) bool {
+		if sr.PushCancel == nil || sr.VerifyError != nil {
+			return true
+		}
+		select {
+		case c <- sr.PushCancel:
+			return true
+		default:
+			return false
+		}
+	}, func() { close(c) })
+	return c, s
+}
+
+// EthPrices subscribes to the ETH/USD price pushes
+func (b *Bus) EthPrices(buffer int) (<-chan *EthPrice, *Subscription) {
+	c := make(chan *EthPrice, buffer)
+	s := b.subscribe(func(sr *SocketResponse) bool {
+		if sr.EthPrice == nil {
+			return true
+		}
+		select {
+		case c <- sr.EthPrice:
+			return true
+		default:
+			return false
+		}
+	}, func() { close(c) })
+	return c, s
+}
+
+// OnTrade calls f for each inserted trade from its own goroutine, buffering
+// up to buffer trades while f is busy
+func (b *Bus) OnTrade(buffer int, f func(*TradeInserted)) *Subscription {
+	c, s := b.Trades(buffer)
+	go func() {
+		for t := range c {
+			f(t)
+		}
+	}()
+	return s
+}
+
+// OnOrder calls f for each inserted order, as OnTrade does
+func (b *Bus) OnOrder(buffer int, f func(*OrderInserted)) *Subscription {
+	c, s := b.Orders(buffer)
+	go func() {
+		for o := range c {
+			f(o)
+		}
+	}()
+	return s
+}
+
+// OnCancel calls f for each cancelled order, as OnTrade does
+func (b *Bus) OnCancel(buffer int, f func(*PushCancel)) *Subscription {
+	c, s := b.Cancels(buffer)
+	go func() {
+		for pc := range c {
+			f(pc)
+		}
+	}()
+	return s
+}
+
+// OnEthPrice calls f for each ETH/USD price push, as OnTrade does
+func (b *Bus) OnEthPrice(buffer int, f func(*EthPrice)) *Subscription {
+	c, s := b.EthPrices(buffer)
+	go func() {
+		for p := range c {
+			f(p)
+		}
+	}()
+	return s
+}
@@ -0,0 +1,364 @@
+package idex
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an exact decimal number, the unscaled integer times 10^-scale.
+// IDEX sends numbers as strings, which are kept digit for digit, trailing
+// zeros included, so numbers marshal back exactly as they were received.
+//
+// The zero value is an unset decimal: it reads as 0 in arithmetic, marshals
+// to null and is what "", "N/A" and null unmarshal to. Those missing values
+// don't round trip, they all marshal back as null.
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+var bigTen = big.NewInt(10)
+
+// maxExponent ParseDecimal accepts, either way
+const maxExponent = 100
+
+// NewDecimal returns unscaled * 10^-scale
+func NewDecimal(unscaled *big.Int, scale int32) Decimal {
+	d := Decimal{unscaled: new(big.Int).Set(unscaled), scale: scale}
+	if scale < 0 {
+		return d.rescale(0, RoundDown)
+	}
+	return d
+}
+
+// NewDecimalFromInt returns i as a Decimal
+func NewDecimalFromInt(i int64) Decimal {
+	return Decimal{unscaled: big.NewInt(i)}
+}
+
+// ParseDecimal reads a decimal such as "-12.034", "5" or "1.5e-8", with an
+// exponent of at most 100 either way
+func ParseDecimal(s string) (Decimal, error) {
+	orig := s
+
+	var exp int64
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", orig)
+		}
+		// IDEX never sends exponents, a huge one only costs a huge power of ten
+		if e < -maxExponent || e > maxExponent {
+			return Decimal{}, fmt.Errorf("decimal %q out of range", orig)
+		}
+		exp = e
+		s = s[:i]
+	}
+
+	var scale int64
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = int64(len(s) - i - 1)
+		s = s[:i] + s[i+1:]
+	}
+
+	digits := strings.TrimLeft(s, "+-")
+	if digits == "" || strings.Trim(digits, "0123456789") != "" || len(s)-len(digits) > 1 {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", orig)
+	}
+
+	u, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", orig)
+	}
+
+	scale -= exp
+	if scale < -1<<31 || scale > 1<<31-1 {
+		return Decimal{}, fmt.Errorf("decimal %q out of range", orig)
+	}
+
+	return NewDecimal(u, int32(scale)), nil
+}
+
+// MustDecimal is ParseDecimal for constants, it panics on invalid input
+func MustDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Valid is false for an unset decimal
+func (d Decimal) Valid() bool {
+	return d.unscaled != nil
+}
+
+// Scale is the number of digits after the decimal point
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Unscaled returns the integer d is made of, before applying the scale
+func (d Decimal) Unscaled() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(d.unscaled)
+}
+
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// String formats d with all of its digits, "0" when unset
+func (d Decimal) String() string {
+	s := d.int().String()
+	if d.scale < 0 && d.Sign() != 0 {
+		return s + strings.Repeat("0", int(-d.scale))
+	}
+	if d.scale <= 0 {
+		return s
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if pad := int(d.scale) + 1 - len(s); pad > 0 {
+		s = strings.Repeat("0", pad) + s
+	}
+	s = s[:len(s)-int(d.scale)] + "." + s[len(s)-int(d.scale):]
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// Float64 is the nearest float64 to d, for display and rough maths only
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// BigInt is the integer part of d
+func (d Decimal) BigInt() *big.Int {
+	return d.rescale(0, RoundDown).Unscaled()
+}
+
+// pow10 returns 10^n
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// align returns the unscaled values of d and e at their common scale
+func align(d, e Decimal) (*big.Int, *big.Int, int32) {
+	a, b := d.int(), e.int()
+	switch {
+	case d.scale > e.scale:
+		b = new(big.Int).Mul(b, pow10(d.scale-e.scale))
+		return a, b, d.scale
+	case e.scale > d.scale:
+		a = new(big.Int).Mul(a, pow10(e.scale-d.scale))
+		return a, b, e.scale
+	}
+	return a, b, d.scale
+}
+
+// Add returns d + e
+func (d Decimal) Add(e Decimal) Decimal {
+	a, b, s := align(d, e)
+	return Decimal{unscaled: new(big.Int).Add(a, b), scale: s}
+}
+
+// Sub returns d - e
+func (d Decimal) Sub(e Decimal) Decimal {
+	a, b, s := align(d, e)
+	return Decimal{unscaled: new(big.Int).Sub(a, b), scale: s}
+}
+
+// Mul returns d * e, exactly
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.int(), e.int()), scale: d.scale + e.scale}
+}
+
+// Div returns d / e with places digits after the point, rounded with mode.
+// It panics when e is zero.
+func (d Decimal) Div(e Decimal, places int32, mode RoundingMode) Decimal {
+	if e.Sign() == 0 {
+		panic("idex: decimal division by zero")
+	}
+
+	// d/e = (a * 10^-sd) / (b * 10^-se), computed at places+1 digits then rounded
+	a := new(big.Int).Mul(d.int(), pow10(places+1+e.scale))
+	b := new(big.Int).Mul(e.int(), pow10(d.scale))
+
+	q, r := new(big.Int).QuoRem(a, b, new(big.Int))
+	// a remainder means digits past places+1, which matter to rounding up
+	if r.Sign() != 0 {
+		q.Mul(q, bigTen)
+		if (r.Sign() < 0) != (b.Sign() < 0) {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+		return Decimal{unscaled: q, scale: places + 2}.rescale(places, mode)
+	}
+	return Decimal{unscaled: q, scale: places + 1}.rescale(places, mode)
+}
+
+// Neg returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Abs returns |d|
+func (d Decimal) Abs() Decimal {
+	return Decimal{unscaled: new(big.Int).Abs(d.int()), scale: d.scale}
+}
+
+// Shift returns d * 10^n, e.g. to move between base units and token amounts
+func (d Decimal) Shift(n int32) Decimal {
+	s := Decimal{unscaled: d.int(), scale: d.scale - n}
+	if s.scale < 0 {
+		return s.rescale(0, RoundDown)
+	}
+	return s
+}
+
+// Cmp compares d and e, returning -1, 0 or +1
+func (d Decimal) Cmp(e Decimal) int {
+	a, b, _ := align(d, e)
+	return a.Cmp(b)
+}
+
+// Equal is true when d and e are the same number, whatever their scale
+func (d Decimal) Equal(e Decimal) bool {
+	return d.Cmp(e) == 0
+}
+
+// Sign returns -1, 0 or +1
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// IsZero is true for 0 and unset decimals
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// RoundingMode decides which way a value between two results goes
+type RoundingMode int
+
+// Rounding modes
+const (
+	// RoundHalfUp rounds to the nearest, halves away from zero
+	RoundHalfUp RoundingMode = iota
+	// RoundDown truncates towards zero
+	RoundDown
+	// RoundUp rounds away from zero
+	RoundUp
+	// RoundFloor rounds towards negative infinity
+	RoundFloor
+	// RoundCeiling rounds towards positive infinity
+	RoundCeiling
+)
+
+// Round d to places digits after the point, halves away from zero
+func (d Decimal) Round(places int32) Decimal {
+	return d.rescale(places, RoundHalfUp)
+}
+
+// Truncate d to places digits after the point
+func (d Decimal) Truncate(places int32) Decimal {
+	return d.rescale(places, RoundDown)
+}
+
+// Floor rounds d down to places digits after the point
+func (d Decimal) Floor(places int32) Decimal {
+	return d.rescale(places, RoundFloor)
+}
+
+// Ceil rounds d up to places digits after the point
+func (d Decimal) Ceil(places int32) Decimal {
+	return d.rescale(places, RoundCeiling)
+}
+
+// RoundTo rounds d to places digits after the point with mode
+func (d Decimal) RoundTo(places int32, mode RoundingMode) Decimal {
+	return d.rescale(places, mode)
+}
+
+// rescale to exactly places digits after the point
+func (d Decimal) rescale(places int32, mode RoundingMode) Decimal {
+	u := d.int()
+	if places >= d.scale {
+		return Decimal{unscaled: new(big.Int).Mul(u, pow10(places-d.scale)), scale: places}
+	}
+
+	div := pow10(d.scale - places)
+	q, r := new(big.Int).QuoRem(u, div, new(big.Int))
+	if r.Sign() == 0 {
+		return Decimal{unscaled: q, scale: places}
+	}
+
+	// QuoRem truncates, so q is already right for the towards zero cases
+	away := false
+	switch mode {
+	case RoundHalfUp:
+		half := new(big.Int).Abs(r)
+		half.Mul(half, big.NewInt(2))
+		away = half.Cmp(div) >= 0
+	case RoundUp:
+		away = true
+	case RoundFloor:
+		away = u.Sign() < 0
+	case RoundCeiling:
+		away = u.Sign() > 0
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(u.Sign())))
+	}
+
+	return Decimal{unscaled: q, scale: places}
+}
+
+// MarshalJSON as a string, the way IDEX sends numbers
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if !d.Valid() {
+		return []byte("null"), nil
+	}
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON from a string or a number
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if string(b) == "null" {
+		*d = Decimal{}
+		return nil
+	}
+
+	s := string(b)
+	if len(b) > 1 && b[0] == '"' {
+		var err error
+		if s, err = strconv.Unquote(s); err != nil {
+			return err
+		}
+		// IDEX uses "N/A" for missing values, e.g. a ticker's high and low
+		if s = strings.TrimSpace(s); s == "" || s == "N/A" {
+			*d = Decimal{}
+			return nil
+		}
+	}
+
+	v, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
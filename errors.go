@@ -0,0 +1,120 @@
+package idex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Common IDEX failures, matchable on an *APIError with errors.Is
+var (
+	ErrMarketNotFound = errors.New("market not found")
+	ErrInvalidAddress = errors.New("invalid address")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrOrderFilled    = errors.New("order already filled")
+	ErrOrderNotFound  = errors.New("order not found")
+	ErrInvalidNonce   = errors.New("invalid nonce")
+)
+
+// Errors from the package itself
+var (
+	// ErrUnknownToken is returned for a token missing from Currencies
+	ErrUnknownToken = errors.New("unknown token")
+	// ErrNoKey is returned when signing without a Signer
+	ErrNoKey = errors.New("no signing key")
+	// ErrInsufficientBalance is returned when withdrawing more than is available
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrBadSignature is returned for events whose signer isn't their user
+	ErrBadSignature = errors.New("bad signature")
+	// ErrTooManyTrades stops a trade history walk at seconds holding more
+	// trades than one request returns, as they can't all be fetched
+	ErrTooManyTrades = errors.New("too many trades in the smallest window")
+	// ErrHandshakeRejected is returned when the websocket server refuses the handshake
+	ErrHandshakeRejected = errors.New("handshake rejected")
+)
+
+// APIError is returned when IDEX answers with an error body or a non-200 status
+type APIError struct {
+	StatusCode int
+	Endpoint   string
+	Payload    string
+	Message    string
+	// RetryAfter is how long the server asked to wait, zero when not given
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("idex %s: %d: %s", e.Endpoint, e.StatusCode, e.Message)
+}
+
+// Is reports whether the server message or status matches one of the common errors
+func (e *APIError) Is(target error) bool {
+	msg := strings.ToLower(e.Message)
+
+	switch target {
+	case ErrMarketNotFound:
+		return strings.Contains(msg, "market") && strings.Contains(msg, "not found")
+	case ErrInvalidAddress:
+		return strings.Contains(msg, "invalid") && strings.Contains(msg, "address")
+	case ErrOrderFilled:
+		// "not found or already filled" doesn't say which, it's only ErrOrderNotFound
+		return orderFilled(msg) && !orderNotFound(msg)
+	case ErrOrderNotFound:
+		return orderNotFound(msg)
+	case ErrInvalidNonce:
+		return strings.Contains(msg, "nonce")
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests ||
+			strings.Contains(msg, "rate limit") ||
+			strings.Contains(msg, "too many requests")
+	}
+	return false
+}
+
+// orderFilled is true for messages saying an order was completely filled,
+// not for "unfilled" or "partially filled"
+func orderFilled(msg string) bool {
+	for _, phrase := range []string{"already filled", "has been filled", "was filled", "fully filled", "completely filled"} {
+		if strings.Contains(msg, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// orderNotFound is true for messages saying an order doesn't exist
+func orderNotFound(msg string) bool {
+	return strings.Contains(msg, "order") &&
+		(strings.Contains(msg, "not found") || strings.Contains(msg, "does not exist") || strings.Contains(msg, "unknown"))
+}
+
+// apiError returns an *APIError when the response is an error, nil otherwise
+func apiError(statusCode int, endpoint, payload string, body []byte) *APIError {
+	e := &struct {
+		Error string `json:"error"`
+	}{}
+	// bodies that aren't an error object simply leave e.Error empty
+	json.Unmarshal(body, e)
+
+	if statusCode == http.StatusOK && e.Error == "" {
+		return nil
+	}
+
+	msg := e.Error
+	if msg == "" {
+		msg = strings.TrimSpace(string(body))
+	}
+	if msg == "" {
+		msg = http.StatusText(statusCode)
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		Endpoint:   endpoint,
+		Payload:    payload,
+		Message:    msg,
+	}
+}
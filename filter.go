@@ -0,0 +1,129 @@
+package idex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Filter picks the trades, orders and cancels Monitor passes on, the other
+// events aren't filtered. Each field left empty matches everything. Cancels
+// carry no tokens, so only Users applies to them.
+//
+// Events are checked before they are fully decoded or verified, so a narrow
+// filter also saves most of the work on the rest of the stream.
+type Filter struct {
+	// Markets such as "ETH_AUC", resolved from the event's tokens with
+	// Socket.Markets
+	Markets []string
+	// Users matched against an event's user, and a trade's buyer and seller
+	Users []string
+	// MinNotional is the smallest order or trade passed on, in the market's
+	// base token, e.g. ETH
+	MinNotional Decimal
+}
+
+// filter is a Filter ready for matching
+type filter struct {
+	src     *Filter
+	markets map[Market]bool
+	users   map[string]bool
+}
+
+func compileFilter(f *Filter) (*filter, error) {
+	c := &filter{src: f}
+	if len(f.Markets) > 0 {
+		c.markets = make(map[Market]bool, len(f.Markets))
+		for _, m := range f.Markets {
+			pm, err := ParseMarket(m)
+			if err != nil {
+				return nil, err
+			}
+			c.markets[pm] = true
+		}
+	}
+	if len(f.Users) > 0 {
+		c.users = make(map[string]bool, len(f.Users))
+		for _, u := range f.Users {
+			c.users[strings.ToLower(u)] = true
+		}
+	}
+	return c, nil
+}
+
+// filterFields of an event, all that's needed to match it
+type filterFields struct {
+	TokenBuy   string          `json:"tokenBuy"`
+	AmountBuy  json.RawMessage `json:"amountBuy"`
+	TokenSell  string          `json:"tokenSell"`
+	AmountSell json.RawMessage `json:"amountSell"`
+	User       string          `json:"user"`
+	Buy        string          `json:"buy"`
+	Sell       string          `json:"sell"`
+}
+
+// match the raw event against f, tokens are false for cancels
+func (f *filter) match(ctx context.Context, r *MarketResolver, raw []byte, tokens bool) (bool, error) {
+	ff := &filterFields{}
+	if err := json.Unmarshal(raw, ff); err != nil {
+		// let the full decoding report it
+		return true, nil
+	}
+
+	if f.users != nil && !f.users[strings.ToLower(ff.User)] &&
+		!f.users[strings.ToLower(ff.Buy)] && !f.users[strings.ToLower(ff.Sell)] {
+		return false, nil
+	}
+	if !tokens || (f.markets == nil && !f.src.MinNotional.Valid()) {
+		return true, nil
+	}
+
+	if r == nil {
+		return false, errors.New("filtering by market needs Socket.Markets")
+	}
+	m, side, err := r.Resolve(ctx, ff.TokenBuy, ff.TokenSell)
+	if errors.Is(err, ErrMarketNotFound) || errors.Is(err, ErrUnknownToken) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if f.markets != nil && !f.markets[m] {
+		return false, nil
+	}
+	if !f.src.MinNotional.Valid() {
+		return true, nil
+	}
+
+	// the base token is the one sold by buy orders
+	amount := ff.AmountBuy
+	if side == Buy {
+		amount = ff.AmountSell
+	}
+	var baseAmount Decimal
+	if err := baseAmount.UnmarshalJSON(amount); err != nil {
+		return false, err
+	}
+	base, err := r.Tokens.Token(ctx, m.Base())
+	if err != nil {
+		return false, err
+	}
+
+	return base.FromBase(baseAmount).Cmp(f.src.MinNotional) >= 0, nil
+}
+
+// keep is true when the raw event passes the socket's filter, a failure to
+// match is sent on c
+func (s *Socket) keep(ctx context.Context, raw []byte, tokens bool, c chan SocketResponse) bool {
+	if s.filter == nil {
+		return true
+	}
+
+	ok, err := s.filter.match(ctx, s.Markets, raw, tokens)
+	if err != nil {
+		s.sendRaw(ctx, c, SocketResponse{Error: fmt.Errorf("filter error: %w", err)})
+	}
+	return ok
+}
@@ -27,7 +27,7 @@ func (v *Volume) UnmarshalJSON(b []byte) error {
 	delete(v.Markets, "totalETH")
 
 	type total struct {
-		TotalETH string `json:"totalETH"`
+		TotalETH Decimal `json:"totalETH"`
 	}
 	t := total{}
 
@@ -0,0 +1,247 @@
+package idex
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TradeHistoryLimit is the most trades IDEX returns for a single request
+const TradeHistoryLimit = 200
+
+// HistoryStart is where iterators stop walking back when no start is given,
+// IDEX went live in September 2017
+var HistoryStart = int(time.Date(2017, time.September, 1, 0, 0, 0, 0, time.UTC).Unix())
+
+// Bounds on the width of trade history windows, in seconds
+const (
+	defaultHistoryWindow = 24 * 60 * 60
+	maxHistoryWindow     = 30 * 24 * 60 * 60
+)
+
+// TradeHistoryQuery selects the trades walked by a TradeHistoryIterator
+type TradeHistoryQuery struct {
+	// Market to walk, or every market traded by Address when empty
+	Market  string
+	Address string
+	// Start and End unix timestamps, default to HistoryStart and now
+	Start int
+	End   int
+	// Forward walks oldest first, the default is newest first
+	Forward bool
+	// Window is the initial width in seconds of each request, default one day
+	Window int
+}
+
+// TradeHistoryIterator walks a trade history window by window, so it isn't
+// capped at TradeHistoryLimit. Windows that come back full are split until
+// they fit, down to a single second, and trades on window boundaries are
+// only returned once. When a single second is full the walk stops with
+// ErrTooManyTrades rather than skip trades.
+type TradeHistoryIterator struct {
+	api    *API
+	q      TradeHistoryQuery
+	cursor int
+	window int
+	done   bool
+	err    error
+
+	// pending trades of the current window and their markets
+	trades  []*Trade
+	markets []string
+	// UUIDs of the previous window, which overlaps the current one by a second
+	seen map[string]bool
+
+	trade  *Trade
+	market string
+}
+
+// TradeHistory returns an iterator over the trades selected by q
+func (a *API) TradeHistory(q TradeHistoryQuery) *TradeHistoryIterator {
+	it := &TradeHistoryIterator{api: a, q: q, seen: map[string]bool{}}
+
+	if q.Market == "" && q.Address == "" {
+		it.err = fmt.Errorf("market or address is required")
+		it.done = true
+		return it
+	}
+	if it.q.Start <= 0 {
+		it.q.Start = HistoryStart
+	}
+	if it.q.End <= 0 {
+		it.q.End = int(time.Now().Unix())
+	}
+	it.window = q.Window
+	if it.window <= 0 {
+		it.window = defaultHistoryWindow
+	}
+
+	if q.Forward {
+		it.cursor = it.q.Start
+	} else {
+		it.cursor = it.q.End
+	}
+	if it.q.Start > it.q.End {
+		it.done = true
+	}
+
+	return it
+}
+
+// Next advances to the next trade, fetching windows as needed. It returns
+// false once the range is exhausted or on error, see Err.
+func (it *TradeHistoryIterator) Next(ctx context.Context) bool {
+	for len(it.trades) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		if it.err = it.fetch(ctx); it.err != nil {
+			return false
+		}
+	}
+
+	it.trade, it.trades = it.trades[0], it.trades[1:]
+	it.market, it.markets = it.markets[0], it.markets[1:]
+	return true
+}
+
+// Trade the iterator is on
+func (it *TradeHistoryIterator) Trade() *Trade {
+	return it.trade
+}
+
+// Market of the current trade
+func (it *TradeHistoryIterator) Market() string {
+	return it.market
+}
+
+// Err that stopped the iteration, if any
+func (it *TradeHistoryIterator) Err() error {
+	return it.err
+}
+
+// fetch the next window, halving it while it comes back full
+func (it *TradeHistoryIterator) fetch(ctx context.Context) error {
+	for {
+		lo, hi := it.bounds()
+
+		trades, markets, err := it.query(ctx, lo, hi)
+		if err != nil {
+			return err
+		}
+
+		// a full window may be hiding trades, shrink it until it isn't full,
+		// down to a single second
+		if len(trades) >= TradeHistoryLimit {
+			if hi > lo {
+				it.window = (hi - lo) / 2
+				continue
+			}
+			return fmt.Errorf("%w: at %d", ErrTooManyTrades, lo)
+		}
+
+		it.queue(trades, markets)
+
+		// windows share their boundary second with the next one, except single
+		// second windows, which would never move on from it
+		if it.q.Forward {
+			it.cursor = hi
+			if lo == hi {
+				it.cursor++
+			}
+			it.done = hi >= it.q.End
+		} else {
+			it.cursor = lo
+			if lo == hi {
+				it.cursor--
+			}
+			it.done = lo <= it.q.Start
+		}
+
+		// sparse windows grow so quiet periods take fewer requests
+		if len(trades) < TradeHistoryLimit/4 && it.window < maxHistoryWindow {
+			it.window *= 2
+			if it.window == 0 {
+				it.window = 1
+			}
+		}
+
+		return nil
+	}
+}
+
+// bounds of the next window, both inclusive
+func (it *TradeHistoryIterator) bounds() (lo, hi int) {
+	if it.q.Forward {
+		lo, hi = it.cursor, it.cursor+it.window
+		if hi > it.q.End {
+			hi = it.q.End
+		}
+		return
+	}
+
+	lo, hi = it.cursor-it.window, it.cursor
+	if lo < it.q.Start {
+		lo = it.q.Start
+	}
+	return
+}
+
+// query trades between lo and hi for the market, or across the user's markets
+func (it *TradeHistoryIterator) query(ctx context.Context, lo, hi int) ([]*Trade, []string, error) {
+	if it.q.Market != "" {
+		ts, err := it.api.TradeHistoryMarketContext(ctx, it.q.Market, it.q.Address, lo, hi)
+		if err != nil {
+			return nil, nil, err
+		}
+		ms := make([]string, len(ts))
+		for i := range ms {
+			ms[i] = it.q.Market
+		}
+		return ts, ms, nil
+	}
+
+	byMarket, err := it.api.TradeHistoryUserContext(ctx, it.q.Address, lo, hi)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ts []*Trade
+	var ms []string
+	for m, mts := range byMarket {
+		for _, t := range mts {
+			ts = append(ts, t)
+			ms = append(ms, m)
+		}
+	}
+	return ts, ms, nil
+}
+
+// queue the window's unseen trades in walking order
+func (it *TradeHistoryIterator) queue(trades []*Trade, markets []string) {
+	idx := make([]int, len(trades))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		if it.q.Forward {
+			return trades[idx[i]].Timestamp.Before(trades[idx[j]].Timestamp.Time)
+		}
+		return trades[idx[i]].Timestamp.After(trades[idx[j]].Timestamp.Time)
+	})
+
+	seen := make(map[string]bool, len(trades))
+	for _, i := range idx {
+		t := trades[i]
+		if t.UUID != "" {
+			dup := it.seen[t.UUID] || seen[t.UUID]
+			seen[t.UUID] = true
+			if dup {
+				continue
+			}
+		}
+		it.trades = append(it.trades, t)
+		it.markets = append(it.markets, markets[i])
+	}
+	it.seen = seen
+}
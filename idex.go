@@ -1,5 +1,7 @@
 package idex
 
+import "crypto/ecdsa"
+
 // Idex service
 type Idex struct {
 	API    *API
@@ -12,7 +14,71 @@ const (
 	WSURL  = "wss://v1.idex.market"
 )
 
+// Option configures an Idex created by New
+type Option func(*Idex)
+
+// WithHTTPClient sets the client used by the API for requests, e.g. an
+// *http.Client with a timeout or custom transport
+func WithHTTPClient(c Doer) Option {
+	return func(i *Idex) {
+		i.API.Client = c
+	}
+}
+
+// WithRetryPolicy retries transient failures of read-only API requests
+func WithRetryPolicy(p *RetryPolicy) Option {
+	return func(i *Idex) {
+		i.API.Retry = p
+	}
+}
+
+// WithRateLimiter throttles all API requests through a shared limiter
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(i *Idex) {
+		i.API.Limiter = l
+	}
+}
+
+// WithSigner signs trading requests with s
+func WithSigner(s Signer) Option {
+	return func(i *Idex) {
+		i.API.Signer = s
+	}
+}
+
+// WithPrivateKey signs trading requests with key, held in memory
+func WithPrivateKey(key *ecdsa.PrivateKey) Option {
+	return WithSigner(NewKeySigner(key))
+}
+
+// WithNonceManager allocates nonces of signed requests locally, seeded from
+// NextNonce and persisted to store when it isn't nil
+func WithNonceManager(store NonceStore) Option {
+	return func(i *Idex) {
+		i.API.Nonces = NewNonceManager(i.API, store)
+	}
+}
+
+// WithAPIURL overrides the rest url
+func WithAPIURL(url string) Option {
+	return func(i *Idex) {
+		i.API.URL = url
+	}
+}
+
+// WithSocketURL overrides the websocket url
+func WithSocketURL(url string) Option {
+	return func(i *Idex) {
+		i.Socket.URL = url
+	}
+}
+
 // New instance of an Idex
-func New() *Idex {
-	return &Idex{API: &API{URL: APIURL}, Socket: &Socket{URL: WSURL}}
+func New(opts ...Option) *Idex {
+	i := &Idex{API: &API{URL: APIURL}, Socket: &Socket{URL: WSURL}}
+	i.Socket.Markets = i.API.resolver()
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
 }
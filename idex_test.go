@@ -1,11 +1,24 @@
 package idex
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/websocket"
 	mockhttp "github.com/karupanerura/go-mock-http-response"
 )
 
@@ -21,9 +34,24 @@ func fileBytes(fileName string) []byte {
 	return b
 }
 
-func mockResponse(statusCode int, body []byte) {
+func mockResponse(statusCode int, body []byte) Option {
 	h := map[string]string{"Content-Type": "application/json"}
-	http.DefaultClient = mockhttp.NewResponseMock(statusCode, h, body).MakeClient()
+	return WithHTTPClient(mockhttp.NewResponseMock(statusCode, h, body).MakeClient())
+}
+
+// doerFunc lets a test answer requests itself
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func response(statusCode int, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}
 }
 
 func TestNew(t *testing.T) {
@@ -37,8 +65,7 @@ func TestNew(t *testing.T) {
 }
 
 func TestTicker(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("ticker.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("ticker.json")))
 
 	tk, err := idex.API.Ticker("ETH_AUC")
 	if err != nil {
@@ -47,20 +74,23 @@ func TestTicker(t *testing.T) {
 	if tk == nil {
 		t.Error("ticker should not be nil")
 	}
-	if tk.Last != "0.00555" {
+	if tk.Last.String() != "0.00555" {
 		t.Errorf("last should be 0.00555, was: %v", tk.Last)
 	}
 }
 
 func TestTickerBadMarket(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("empty.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("empty.json")))
 
 	_, err := idex.API.Ticker("INVALID")
 	if err == nil {
 		t.Error("should be an error")
 	}
 
+	if !errors.Is(err, ErrMarketNotFound) {
+		t.Errorf("should be a market not found error, was: %v", err)
+	}
+
 	_, err = idex.API.Ticker("")
 	if err == nil {
 		t.Error("should be an error")
@@ -68,9 +98,334 @@ func TestTickerBadMarket(t *testing.T) {
 
 }
 
+func TestAPIError(t *testing.T) {
+	idex := New(mockResponse(http.StatusOK, fileBytes("error.json")))
+
+	_, err := idex.API.OrderBook("ETH_BTC")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("should be an APIError, was: %v", err)
+	}
+	if was, exp := apiErr.Message, "Market ETH_BTC not found"; was != exp {
+		t.Errorf("message should be %v, was: %v", exp, was)
+	}
+	if was, exp := apiErr.Endpoint, "returnOrderBook"; was != exp {
+		t.Errorf("endpoint should be %v, was: %v", exp, was)
+	}
+	if !errors.Is(err, ErrMarketNotFound) {
+		t.Error("should be a market not found error")
+	}
+	if errors.Is(err, ErrRateLimited) {
+		t.Error("should not be a rate limited error")
+	}
+
+	idex = New(mockResponse(http.StatusTooManyRequests, []byte("Too Many Requests")))
+
+	_, err = idex.API.Tickers()
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("should be an APIError, was: %v", err)
+	}
+	if was, exp := apiErr.StatusCode, http.StatusTooManyRequests; was != exp {
+		t.Errorf("status should be %v, was: %v", exp, was)
+	}
+	if !errors.Is(err, ErrRateLimited) {
+		t.Error("should be a rate limited error")
+	}
+
+	idex = New(mockResponse(http.StatusOK, []byte(`{"error":"Invalid address"}`)))
+
+	_, err = idex.API.Balances("0xnope")
+	if !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("should be an invalid address error, was: %v", err)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	c := &http.Client{Timeout: time.Second}
+	idex := New(WithHTTPClient(c), WithAPIURL("http://localhost"), WithSocketURL("ws://localhost"))
+	if idex.API.Client != c {
+		t.Error("API should use the given client")
+	}
+	if was, exp := idex.API.URL, "http://localhost"; was != exp {
+		t.Errorf("API url should be %v, was: %v", exp, was)
+	}
+	if was, exp := idex.Socket.URL, "ws://localhost"; was != exp {
+		t.Errorf("Socket url should be %v, was: %v", exp, was)
+	}
+}
+
+func TestTickerContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	api := &API{URL: srv.URL, Client: srv.Client()}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := api.TickerContext(ctx, "ETH_AUC")
+	if err == nil {
+		t.Error("should be an error")
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("context should have hit its deadline, was: %v", ctx.Err())
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	calls := 0
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls < 3 {
+			r := response(http.StatusServiceUnavailable, []byte("unavailable"))
+			r.Header.Set("Retry-After", "0")
+			return r, nil
+		}
+		return response(http.StatusOK, fileBytes("tickers.json")), nil
+	})
+
+	var retries []RetryEvent
+	policy := &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+		OnRetry:     func(e RetryEvent) { retries = append(retries, e) },
+	}
+	idex := New(WithHTTPClient(doer), WithRetryPolicy(policy))
+
+	tks, err := idex.API.Tickers()
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if was, exp := len(tks), 3; was != exp {
+		t.Errorf("there should be %v tickers, was: %v", exp, was)
+	}
+	if was, exp := len(retries), 2; was != exp {
+		t.Fatalf("there should be %v retries, was: %v", exp, was)
+	}
+	if was, exp := retries[1].Attempt, 2; was != exp {
+		t.Errorf("second retry should follow attempt %v, was: %v", exp, was)
+	}
+	if was, exp := retries[0].Endpoint, "returnTicker"; was != exp {
+		t.Errorf("retried endpoint should be %v, was: %v", exp, was)
+	}
+
+	// state changing endpoints are never retried
+	calls = 0
+	if _, err := idex.API.Post("order", "{}"); err == nil {
+		t.Error("should be an error")
+	}
+	if was, exp := calls, 1; was != exp {
+		t.Errorf("there should be %v call, was: %v", exp, was)
+	}
+
+	// client errors aren't retried either
+	calls = 0
+	doer = doerFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return response(http.StatusOK, fileBytes("error.json")), nil
+	})
+	idex = New(WithHTTPClient(doer), WithRetryPolicy(policy))
+	if _, err := idex.API.OrderBook("ETH_BTC"); err == nil {
+		t.Error("should be an error")
+	}
+	if was, exp := calls, 1; was != exp {
+		t.Errorf("there should be %v call, was: %v", exp, was)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if was, exp := parseRetryAfter("3"), 3*time.Second; was != exp {
+		t.Errorf("retry after should be %v, was: %v", exp, was)
+	}
+	if was := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); was < 59*time.Minute {
+		t.Errorf("retry after should be about an hour, was: %v", was)
+	}
+	if was := parseRetryAfter("soon"); was != 0 {
+		t.Errorf("retry after should be 0, was: %v", was)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(100, 4)
+	if was, exp := l.Weight("returnOrderBook"), 4; was != exp {
+		t.Errorf("order book weight should be %v, was: %v", exp, was)
+	}
+	if was, exp := l.Weight("returnTicker"), 1; was != exp {
+		t.Errorf("ticker weight should be %v, was: %v", exp, was)
+	}
+
+	idex := New(mockResponse(http.StatusOK, fileBytes("orderBook.json")), WithRateLimiter(l))
+
+	// the bucket starts full, so the first call doesn't wait
+	start := time.Now()
+	if _, err := idex.API.OrderBook("ETH_SAN"); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if d := time.Since(start); d > 20*time.Millisecond {
+		t.Errorf("first call should not wait, took: %v", d)
+	}
+
+	// the second needs 4 new tokens, 40ms at 100/s
+	start = time.Now()
+	if _, err := idex.API.OrderBook("ETH_SAN"); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("second call should wait for tokens, took: %v", d)
+	}
+
+	// a deadline shorter than the wait gives up immediately
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := idex.API.OrderBookContext(ctx, "ETH_SAN"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("should be a deadline error, was: %v", err)
+	}
+}
+
+func TestTimes(t *testing.T) {
+	ts := fileBytes("orderTrades.json")
+	trades := []*Trade{}
+	if err := json.Unmarshal(ts, &trades); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	tr := trades[0]
+	exp := time.Date(2018, time.July, 9, 16, 41, 24, 0, time.UTC)
+	if !tr.Date.Equal(exp) || tr.Date.Location() != time.UTC {
+		t.Errorf("date should be %v, was: %v", exp, tr.Date)
+	}
+	if !tr.Timestamp.Equal(exp) {
+		t.Errorf("timestamp should be %v, was: %v", exp, tr.Timestamp)
+	}
+
+	b, err := json.Marshal(tr)
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	round := &Trade{}
+	if err := json.Unmarshal(b, round); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if !round.Date.Equal(tr.Date.Time) || !round.Timestamp.Equal(tr.Timestamp.Time) {
+		t.Errorf("trade times should round trip, was: %v %v", round.Date, round.Timestamp)
+	}
+
+	pc := &PushCancel{}
+	in := `{"updatedAt":"2018-08-31T22:10:52.000Z","createdAt":"2018-08-31T22:10:52Z"}`
+	if err := json.Unmarshal([]byte(in), pc); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	b, err = json.Marshal(pc)
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if !bytes.Contains(b, []byte(`"updatedAt":"2018-08-31T22:10:52.000Z","createdAt":"2018-08-31T22:10:52.000Z"`)) {
+		t.Errorf("cancel times should marshal in IDEX format, was: %s", b)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	for _, s := range []string{"0", "0.987654321000000", "-12.5", "20146610957659998010000", "0.000000000000055555"} {
+		d, err := ParseDecimal(s)
+		if err != nil {
+			t.Errorf("should not be an error: %v", err)
+		}
+		if was := d.String(); was != s {
+			t.Errorf("decimal should print as %v, was: %v", s, was)
+		}
+	}
+	for _, s := range []string{"", ".", "1.2.3", "--1", "1-2", "abc", "N/A", "1e200000000", "1e-200000000", "1e101"} {
+		if _, err := ParseDecimal(s); err == nil {
+			t.Errorf("%q should be an error", s)
+		}
+	}
+	if was, exp := MustDecimal("1.5e-8").String(), "0.000000015"; was != exp {
+		t.Errorf("decimal should be %v, was: %v", exp, was)
+	}
+	var huge Decimal
+	if err := json.Unmarshal([]byte(`"1e200000000"`), &huge); err == nil {
+		t.Error("a huge exponent should be an error")
+	}
+
+	a, b := MustDecimal("0.1"), MustDecimal("0.2")
+	if was, exp := a.Add(b).String(), "0.3"; was != exp {
+		t.Errorf("sum should be %v, was: %v", exp, was)
+	}
+	if was, exp := a.Sub(b).String(), "-0.1"; was != exp {
+		t.Errorf("difference should be %v, was: %v", exp, was)
+	}
+	if was, exp := a.Mul(b).String(), "0.02"; was != exp {
+		t.Errorf("product should be %v, was: %v", exp, was)
+	}
+	if was, exp := MustDecimal("2").Div(MustDecimal("3"), 4, RoundHalfUp).String(), "0.6667"; was != exp {
+		t.Errorf("quotient should be %v, was: %v", exp, was)
+	}
+	if was, exp := MustDecimal("-2").Div(MustDecimal("3"), 4, RoundFloor).String(), "-0.6667"; was != exp {
+		t.Errorf("quotient should be %v, was: %v", exp, was)
+	}
+	if !MustDecimal("1.50").Equal(MustDecimal("1.5")) {
+		t.Error("1.50 should equal 1.5")
+	}
+	if MustDecimal("0.00555").Cmp(MustDecimal("0.0056")) != -1 {
+		t.Error("0.00555 should be less than 0.0056")
+	}
+
+	d := MustDecimal("1.2345")
+	if was, exp := d.Round(3).String(), "1.235"; was != exp {
+		t.Errorf("round should be %v, was: %v", exp, was)
+	}
+	if was, exp := d.Truncate(3).String(), "1.234"; was != exp {
+		t.Errorf("truncate should be %v, was: %v", exp, was)
+	}
+	if was, exp := d.Neg().Floor(2).String(), "-1.24"; was != exp {
+		t.Errorf("floor should be %v, was: %v", exp, was)
+	}
+	if was, exp := d.Ceil(2).String(), "1.24"; was != exp {
+		t.Errorf("ceil should be %v, was: %v", exp, was)
+	}
+	if was, exp := d.Shift(18).String(), "1234500000000000000"; was != exp {
+		t.Errorf("shift should be %v, was: %v", exp, was)
+	}
+	if was, exp := MustDecimal("1978850017439473664").Shift(-18).String(), "1.978850017439473664"; was != exp {
+		t.Errorf("shift should be %v, was: %v", exp, was)
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	tk := &Ticker{}
+	if err := json.Unmarshal(fileBytes("ticker.json"), tk); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if tk.High.Valid() {
+		t.Error("N/A high should not be valid")
+	}
+	if !tk.Last.Valid() {
+		t.Error("last should be valid")
+	}
+
+	b := &Balance{}
+	in := `{"available":"0.987654321000000","onOrders":12.777}`
+	if err := json.Unmarshal([]byte(in), b); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	out, err := json.Marshal(b)
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if was, exp := string(out), `{"available":"0.987654321000000","onOrders":"12.777"}`; was != exp {
+		t.Errorf("balance should marshal to %v, was: %v", exp, was)
+	}
+
+	if err := json.Unmarshal([]byte(`{"available":"lots"}`), b); err == nil {
+		t.Error("should be an error")
+	}
+}
+
 func TestTickers(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("tickers.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("tickers.json")))
 
 	tks, err := idex.API.Tickers()
 	if err != nil {
@@ -85,14 +440,13 @@ func TestTickers(t *testing.T) {
 	if tks["ETH_AUC"] == nil {
 		t.Error("ETH_SAN market should exist")
 	}
-	if was, exp := tks["ETH_AUC"].Last, "0.000207186721315823"; was != exp {
+	if was, exp := tks["ETH_AUC"].Last.String(), "0.000207186721315823"; was != exp {
 		t.Errorf("last should %v, was: %v", exp, was)
 	}
 }
 
 func TestVolume24(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("volume24.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("volume24.json")))
 
 	vol, err := idex.API.Volume24()
 	if err != nil {
@@ -104,17 +458,16 @@ func TestVolume24(t *testing.T) {
 	if vol.Markets["ETH_AUC"] == nil {
 		t.Error("market should exist")
 	}
-	if was, exp := vol.Markets["ETH_AUC"]["AUC"], "209849.917899637864109753"; was != exp {
+	if was, exp := vol.Markets["ETH_AUC"]["AUC"].String(), "209849.917899637864109753"; was != exp {
 		t.Errorf("volume should be %v, was: %v", exp, was)
 	}
-	if vol.TotalETH != "14148.11678323491238745" {
+	if vol.TotalETH.String() != "14148.11678323491238745" {
 		t.Errorf("TotalETH should be 12.234, was: %v", vol.TotalETH)
 	}
 }
 
 func TestReturnOrderBook(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("orderBook.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("orderBook.json")))
 
 	ob, err := idex.API.OrderBook("ETH_SAN")
 	if err != nil {
@@ -132,17 +485,16 @@ func TestReturnOrderBook(t *testing.T) {
 	if was, exp := len(ob.Bids), 6; was != exp {
 		t.Errorf("there should be %v bids, was: %v", exp, was)
 	}
-	if was, exp := ob.Asks[0].Price, "0.00342003"; was != exp {
+	if was, exp := ob.Asks[0].Price.String(), "0.00342003"; was != exp {
 		t.Errorf("first ask price should be %v, was: %v", exp, was)
 	}
-	if was, exp := ob.Bids[0].Amount, "2222"; was != exp {
+	if was, exp := ob.Bids[0].Amount.String(), "2222"; was != exp {
 		t.Errorf("first bid amount should be %v, was: %v", exp, was)
 	}
 }
 
 func TestOpenOrdersMarket(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("openOrdersMarket.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("openOrdersMarket.json")))
 
 	os, err := idex.API.OpenOrders("ETH_SAN", "")
 	if err != nil {
@@ -151,17 +503,16 @@ func TestOpenOrdersMarket(t *testing.T) {
 	if was, exp := len(os), 12; was != exp {
 		t.Errorf("there should be %v orders, was: %v", exp, was)
 	}
-	if was, exp := os[0].Timestamp, 1518721278; was != exp {
+	if was, exp := os[0].Timestamp.Unix(), int64(1518721278); was != exp {
 		t.Errorf("first open order timestamp should be %v, was: %v", exp, was)
 	}
-	if was, exp := os[0].Params.AmountBuy, "1999999999999999999"; was != exp {
+	if was, exp := os[0].Params.AmountBuy.String(), "1999999999999999999"; was != exp {
 		t.Errorf("first open order amount buy should be %v, was: %v", exp, was)
 	}
 }
 
 func TestOpenOrdersUser(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("openOrdersUser.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("openOrdersUser.json")))
 
 	os, err := idex.API.OpenOrders("", "0x1234567890")
 	if err != nil {
@@ -173,7 +524,7 @@ func TestOpenOrdersUser(t *testing.T) {
 	if was, exp := os[0].Market, "ETH_PARETO"; was != exp {
 		t.Errorf("first open order market should be %v, was: %v", exp, was)
 	}
-	if was, exp := os[0].Params.AmountSell, "20146610957659998010000"; was != exp {
+	if was, exp := os[0].Params.AmountSell.String(), "20146610957659998010000"; was != exp {
 		t.Errorf("first open order market should be %v, was: %v", exp, was)
 	}
 
@@ -184,8 +535,7 @@ func TestOpenOrdersUser(t *testing.T) {
 }
 
 func TestTradeHistoryMarket(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("tradeHistoryMarket.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("tradeHistoryMarket.json")))
 
 	ts, err := idex.API.TradeHistoryMarket("ETH_SAN", "", 0, 0)
 	if err != nil {
@@ -194,10 +544,10 @@ func TestTradeHistoryMarket(t *testing.T) {
 	if was, exp := len(ts), 22; was != exp {
 		t.Errorf("there should be %v trades, was: %v", exp, was)
 	}
-	if was, exp := ts[0].Total, "0.150496412698412699"; was != exp {
+	if was, exp := ts[0].Total.String(), "0.150496412698412699"; was != exp {
 		t.Errorf("first trade history total should be %v, was: %v", exp, was)
 	}
-	if was, exp := ts[1].Total, "0.5418851999999997"; was != exp {
+	if was, exp := ts[1].Total.String(), "0.5418851999999997"; was != exp {
 		t.Errorf("second trade history total should be %v, was: %v", exp, was)
 	}
 
@@ -223,9 +573,36 @@ func TestTradeHistoryMarket(t *testing.T) {
 	}
 }
 
+func TestPayloads(t *testing.T) {
+	var payload string
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		payload = string(b)
+		return response(http.StatusOK, []byte("[]")), nil
+	})
+	idex := New(WithHTTPClient(doer))
+
+	idex.API.TradeHistoryMarket(`ETH_"SAN`, "", 0, 0)
+	if was, exp := payload, `{"market":"ETH_\"SAN"}`; was != exp {
+		t.Errorf("payload should be %v, was: %v", exp, was)
+	}
+
+	idex.API.TradeHistoryMarket("ETH_SAN", "0x1234567890", 1531000000, 1532000000)
+	if was, exp := payload, `{"market":"ETH_SAN","address":"0x1234567890","start":1531000000,"end":1532000000}`; was != exp {
+		t.Errorf("payload should be %v, was: %v", exp, was)
+	}
+
+	idex.API.OpenOrders("", `0x12\34`)
+	if was, exp := payload, `{"address":"0x12\\34"}`; was != exp {
+		t.Errorf("payload should be %v, was: %v", exp, was)
+	}
+}
+
 func TestTradeHistoryUser(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("tradeHistoryUser.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("tradeHistoryUser.json")))
 
 	ts, err := idex.API.TradeHistoryUser("0x1234567890", 0, 0)
 	if err != nil {
@@ -237,10 +614,10 @@ func TestTradeHistoryUser(t *testing.T) {
 	if was, exp := len(ts["ETH_SAN"]), 2; was != exp {
 		t.Errorf("there should be %v trades on ETH_SAN, was: %v", exp, was)
 	}
-	if was, exp := ts["ETH_SAN"][0].Total, "0.150496412698412699"; was != exp {
+	if was, exp := ts["ETH_SAN"][0].Total.String(), "0.150496412698412699"; was != exp {
 		t.Errorf("first trade history total should be %v, was: %v", exp, was)
 	}
-	if was, exp := ts["ETH_SAN"][0].USDValue, "105.3474888888888893"; was != exp {
+	if was, exp := ts["ETH_SAN"][0].USDValue.String(), "105.3474888888888893"; was != exp {
 		t.Errorf("first trade history usdValue should be %v, was: %v", exp, was)
 	}
 
@@ -250,9 +627,144 @@ func TestTradeHistoryUser(t *testing.T) {
 	}
 }
 
+// historyServer answers trade history requests from trades, newest first and
+// capped like IDEX
+func historyServer(trades []*Trade, requests *int) Doer {
+	return doerFunc(func(req *http.Request) (*http.Response, error) {
+		*requests++
+		q := &struct {
+			Start int `json:"start"`
+			End   int `json:"end"`
+		}{}
+		if err := json.NewDecoder(req.Body).Decode(q); err != nil {
+			return nil, err
+		}
+
+		var ts []*Trade
+		for i := len(trades) - 1; i >= 0 && len(ts) < TradeHistoryLimit; i-- {
+			if sec := int(trades[i].Timestamp.Unix()); sec >= q.Start && sec <= q.End {
+				ts = append(ts, trades[i])
+			}
+		}
+		b, err := json.Marshal(ts)
+		if err != nil {
+			return nil, err
+		}
+		return response(http.StatusOK, b), nil
+	})
+}
+
+func TestTradeHistoryIterator(t *testing.T) {
+	// 1000 trades, 5 per second
+	var trades []*Trade
+	for i := 0; i < 1000; i++ {
+		trades = append(trades, &Trade{UUID: fmt.Sprintf("t%d", i), Timestamp: NewUnixTime(int64(1530000000 + i/5))})
+	}
+
+	requests := 0
+	idex := New(WithHTTPClient(historyServer(trades, &requests)))
+	q := TradeHistoryQuery{Market: "ETH_SAN", Start: 1530000000, End: 1530001000, Window: 600}
+
+	it := idex.API.TradeHistory(q)
+	uuids := map[string]bool{}
+	last := int64(q.End)
+	for it.Next(context.Background()) {
+		tr := it.Trade()
+		if uuids[tr.UUID] {
+			t.Errorf("trade %v returned twice", tr.UUID)
+		}
+		uuids[tr.UUID] = true
+		if tr.Timestamp.Unix() > last {
+			t.Errorf("trades should be newest first, %v came after %v", tr.Timestamp, last)
+		}
+		last = tr.Timestamp.Unix()
+		if it.Market() != "ETH_SAN" {
+			t.Errorf("market should be ETH_SAN, was: %v", it.Market())
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if was, exp := len(uuids), 1000; was != exp {
+		t.Errorf("there should be %v trades, was: %v", exp, was)
+	}
+	if requests > 60 {
+		t.Errorf("walking back should take fewer requests, was: %v", requests)
+	}
+
+	q.Forward = true
+	it = idex.API.TradeHistory(q)
+	count, first := 0, int64(q.Start)
+	for it.Next(context.Background()) {
+		if it.Trade().Timestamp.Unix() < first {
+			t.Errorf("trades should be oldest first, %v came after %v", it.Trade().Timestamp, first)
+		}
+		first = it.Trade().Timestamp.Unix()
+		count++
+	}
+	if was, exp := count, 1000; was != exp {
+		t.Errorf("there should be %v trades, was: %v", exp, was)
+	}
+
+	// a burst of 300 trades in one second can't be fetched whole
+	for i := 1000; i < 1300; i++ {
+		trades = append(trades, &Trade{UUID: fmt.Sprintf("t%d", i), Timestamp: NewUnixTime(1530000100)})
+	}
+	idex = New(WithHTTPClient(historyServer(trades, &requests)))
+	q.Forward = false
+	it = idex.API.TradeHistory(q)
+	count = 0
+	for it.Next(context.Background()) {
+		if it.Trade().Timestamp.Unix() < 1530000100 {
+			t.Errorf("trades before the burst should not be returned, was: %v", it.Trade().Timestamp)
+		}
+		count++
+	}
+	if !errors.Is(it.Err(), ErrTooManyTrades) {
+		t.Errorf("should be a too many trades error, was: %v", it.Err())
+	}
+	if count == 0 {
+		t.Error("trades after the burst should be returned first")
+	}
+
+	// 150 trades in each of two seconds only fit one second at a time
+	trades = nil
+	for i := 0; i < 300; i++ {
+		trades = append(trades, &Trade{UUID: fmt.Sprintf("t%d", i), Timestamp: NewUnixTime(int64(1530000100 + i/150))})
+	}
+	for i := 300; i < 400; i++ {
+		trades = append(trades, &Trade{UUID: fmt.Sprintf("t%d", i), Timestamp: NewUnixTime(int64(1530000000 + i - 300))})
+	}
+	idex = New(WithHTTPClient(historyServer(trades, &requests)))
+	for _, forward := range []bool{false, true} {
+		q.Forward = forward
+		it = idex.API.TradeHistory(q)
+		uuids := map[string]bool{}
+		for it.Next(context.Background()) {
+			if uuids[it.Trade().UUID] {
+				t.Errorf("trade %v returned twice", it.Trade().UUID)
+			}
+			uuids[it.Trade().UUID] = true
+		}
+		if err := it.Err(); err != nil {
+			t.Errorf("forward %v should not be an error: %v", forward, err)
+		}
+		if was, exp := len(uuids), 400; was != exp {
+			t.Errorf("forward %v should walk %v trades, was: %v", forward, exp, was)
+		}
+	}
+
+	it = idex.API.TradeHistory(TradeHistoryQuery{})
+	if it.Next(context.Background()) {
+		t.Error("should not iterate without market or address")
+	}
+	if it.Err() == nil {
+		t.Error("should be an error")
+	}
+}
+
 func TestCurrencies(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("currencies.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("currencies.json")))
 
 	cs, err := idex.API.Currencies()
 	if err != nil {
@@ -269,9 +781,117 @@ func TestCurrencies(t *testing.T) {
 	}
 }
 
+func TestTokenRegistry(t *testing.T) {
+	requests := 0
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return response(http.StatusOK, fileBytes("currencies.json")), nil
+	})
+	r := NewTokenRegistry(New(WithHTTPClient(doer)).API)
+	ctx := context.Background()
+
+	tk, err := r.Token(ctx, "0xD8912C10681D8B21FD3742244F44658DBA12264E")
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if was, exp := tk.Symbol, "PLU"; was != exp {
+		t.Errorf("token should be %v, was: %v", exp, was)
+	}
+
+	eth, err := r.Token(ctx, "ETH")
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if was, exp := eth.Address, "0x0000000000000000000000000000000000000000"; was != exp {
+		t.Errorf("ETH address should be %v, was: %v", exp, was)
+	}
+
+	base, err := r.ToBase(ctx, "ETH", MustDecimal("1.978850017439473664"))
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if was, exp := base.String(), "1978850017439473664"; was != exp {
+		t.Errorf("base amount should be %v, was: %v", exp, was)
+	}
+	human, err := r.FromBase(ctx, "1ST", MustDecimal("20000000000000000"))
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if was, exp := human.String(), "0.020000000000000000"; was != exp {
+		t.Errorf("human amount should be %v, was: %v", exp, was)
+	}
+
+	// an unknown token was just refreshed for, so it doesn't hit the API again
+	if _, err := r.Token(ctx, "NOPE"); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("should be an unknown token error, was: %v", err)
+	}
+	if was, exp := requests, 1; was != exp {
+		t.Errorf("there should be %v request, was: %v", exp, was)
+	}
+}
+
+func TestParseMarket(t *testing.T) {
+	m, err := ParseMarket("ETH_AUC")
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if m.Base() != "ETH" || m.Quote() != "AUC" {
+		t.Errorf("market should be ETH and AUC, was: %v and %v", m.Base(), m.Quote())
+	}
+	for _, s := range []string{"", "ETH", "ETH_", "_AUC", "ETH_AUC_X", "ETH-AUC", `ETH_"AUC`} {
+		if _, err := ParseMarket(s); err == nil {
+			t.Errorf("%q should be an error", s)
+		}
+	}
+}
+
+func TestMarkets(t *testing.T) {
+	idex := New(mockResponse(http.StatusOK, fileBytes("tickers.json")))
+
+	ms, err := idex.API.Markets()
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if was, exp := fmt.Sprint(ms), "[ETH_AUC ETH_DX ETH_PKT]"; was != exp {
+		t.Errorf("markets should be %v, was: %v", exp, was)
+	}
+}
+
+func TestMarketResolver(t *testing.T) {
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/returnCurrencies" {
+			return response(http.StatusOK, fileBytes("currencies.json")), nil
+		}
+		return response(http.StatusOK, []byte(`{"ETH_PLU":{"last":"0.01"}}`)), nil
+	})
+	r := NewMarketResolver(New(WithHTTPClient(doer), WithAPIURL("http://idex")).API)
+	ctx := context.Background()
+	eth := "0x0000000000000000000000000000000000000000"
+	plu := "0xD8912C10681D8B21FD3742244F44658DBA12264E"
+
+	m, s, err := r.Resolve(ctx, plu, eth)
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if m != "ETH_PLU" || s != Buy {
+		t.Errorf("should be a buy on ETH_PLU, was: %v on %v", s, m)
+	}
+
+	m, s, err = r.Resolve(ctx, eth, plu)
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if m != "ETH_PLU" || s != Sell {
+		t.Errorf("should be a sell on ETH_PLU, was: %v on %v", s, m)
+	}
+
+	if _, _, err := r.Resolve(ctx, plu, "0xaf30d2a7e90d7dc361c8c4585e9bb7d2f6f15bc7"); !errors.Is(err, ErrMarketNotFound) {
+		t.Errorf("should be a market not found error, was: %v", err)
+	}
+}
+
 func TestBalances(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("balances.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("balances.json")))
 
 	bs, err := idex.API.Balances("0x1234567890")
 	if err != nil {
@@ -283,7 +903,7 @@ func TestBalances(t *testing.T) {
 	if was, exp := len(bs), 4; was != exp {
 		t.Errorf("there should be %v deposits, was: %v", exp, was)
 	}
-	if was, exp := bs["NPXS"], "0.000000000000055555"; was != exp {
+	if was, exp := bs["NPXS"].String(), "0.000000000000055555"; was != exp {
 		t.Errorf("NPXS balance should be %v, was: %v", exp, was)
 	}
 
@@ -294,8 +914,7 @@ func TestBalances(t *testing.T) {
 }
 
 func TestCompleteBalances(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("completeBalances.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("completeBalances.json")))
 
 	bs, err := idex.API.CompleteBalances("0x1234567890")
 	if err != nil {
@@ -307,10 +926,10 @@ func TestCompleteBalances(t *testing.T) {
 	if bs["ETH"] == nil {
 		t.Error("ETH should be included")
 	}
-	if was, exp := bs["ETH"].Available, "0.987654321000000"; was != exp {
+	if was, exp := bs["ETH"].Available.String(), "0.987654321000000"; was != exp {
 		t.Errorf("ETH available balance should be %v, was: %v", exp, was)
 	}
-	if was, exp := bs["ETH"].OnOrders, "12.777"; was != exp {
+	if was, exp := bs["ETH"].OnOrders.String(), "12.777"; was != exp {
 		t.Errorf("ETH on order balance should be %v, was: %v", exp, was)
 	}
 
@@ -321,8 +940,7 @@ func TestCompleteBalances(t *testing.T) {
 }
 
 func TestDepositsWithdrawals(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("depositsWithdrawals.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("depositsWithdrawals.json")))
 
 	ds, ws, err := idex.API.DepositsWithdrawals("0x1234567890", 0, 0)
 	if err != nil {
@@ -347,8 +965,7 @@ func TestDepositsWithdrawals(t *testing.T) {
 }
 
 func TestOrderTrades(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("orderTrades.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("orderTrades.json")))
 
 	ts, err := idex.API.OrderTrades("0x9876543210")
 	if err != nil {
@@ -357,10 +974,10 @@ func TestOrderTrades(t *testing.T) {
 	if was, exp := len(ts), 1; was != exp {
 		t.Errorf("there should be %v trades, was: %v", exp, was)
 	}
-	if was, exp := ts[0].Amount, "74.503174603174603704"; was != exp {
+	if was, exp := ts[0].Amount.String(), "74.503174603174603704"; was != exp {
 		t.Errorf("first trade's amount should be %v, was: %v", exp, was)
 	}
-	if was, exp := ts[0].Price, "0.00202"; was != exp {
+	if was, exp := ts[0].Price.String(), "0.00202"; was != exp {
 		t.Errorf("first trade's price should be %v, was: %v", exp, was)
 	}
 
@@ -372,8 +989,7 @@ func TestOrderTrades(t *testing.T) {
 }
 
 func TestNextNonce(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("nextNonce.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("nextNonce.json")))
 
 	n, err := idex.API.NextNonce("0x1234567890")
 	if err != nil {
@@ -389,9 +1005,123 @@ func TestNextNonce(t *testing.T) {
 	}
 }
 
+func TestNonceManager(t *testing.T) {
+	ex := newExchange()
+	api := New(WithHTTPClient(ex), WithAPIURL("http://idex")).API
+	store := &FileNonceStore{Path: filepath.Join(t.TempDir(), "nonces.json")}
+	m := NewNonceManager(api, store)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := map[int]bool{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := m.Next(ctx, "0xABC")
+			if err != nil {
+				t.Errorf("should not be an error: %v", err)
+			}
+			mu.Lock()
+			seen[n] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	for n := 2468; n < 2518; n++ {
+		if !seen[n] {
+			t.Errorf("nonce %v should have been handed out", n)
+		}
+	}
+
+	// a restarted manager picks up from the store, ahead of the server
+	m = NewNonceManager(api, store)
+	if n, err := m.Next(ctx, "0xabc"); err != nil || n != 2518 {
+		t.Errorf("nonce should be 2518, was: %v, %v", n, err)
+	}
+
+	// and jumps forward when the server is ahead
+	ex.replies["returnNextNonce"] = []byte(`{"nonce":3000}`)
+	if err := m.Resync(ctx, "0xabc"); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if n, err := m.Reserve(ctx, "0xabc", 3); err != nil || n != 3000 {
+		t.Errorf("nonce should be 3000, was: %v, %v", n, err)
+	}
+	if n, err := m.Next(ctx, "0xabc"); err != nil || n != 3003 {
+		t.Errorf("nonce should be 3003, was: %v, %v", n, err)
+	}
+}
+
+func TestNonceSeedDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	c := doerFunc(func(req *http.Request) (*http.Response, error) {
+		b, _ := ioutil.ReadAll(req.Body)
+		if bytes.Contains(b, []byte("0xslow")) {
+			select {
+			case <-release:
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+		return response(http.StatusOK, fileBytes("nextNonce.json")), nil
+	})
+	m := NewNonceManager(New(WithHTTPClient(c), WithAPIURL("http://idex")).API, nil)
+
+	go m.Next(context.Background(), "0xslow")
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if n, err := m.Next(context.Background(), "0xfast"); err != nil || n != 2468 {
+			t.Errorf("nonce should be 2468, was: %v, %v", n, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("a slow seed should not block other addresses")
+	}
+}
+
+func TestNonceResyncOnRejection(t *testing.T) {
+	key, err := crypto.HexToECDSA(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex := newExchange()
+	ex.replies["cancel"] = []byte(`{"error":"Invalid nonce"}`)
+	idex := New(WithHTTPClient(ex), WithAPIURL("http://idex"), WithPrivateKey(key), WithNonceManager(nil))
+	hash := "0x1f074c92c4fa39b682c2c5c3e0d07ce8fd05d24f42b8e6c96d47dd7182986730"
+
+	if _, err := idex.API.Cancel(hash); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("should be an invalid nonce error, was: %v", err)
+	}
+
+	// the next rejection resyncs to the server's nonce, used from then on
+	ex.replies["returnNextNonce"] = []byte(`{"nonce":5000}`)
+	idex.API.Cancel(hash)
+	ex.replies["cancel"] = []byte(`{"success":1}`)
+	if _, err := idex.API.Cancel(hash); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+
+	p := &cancelPayload{}
+	if err := json.Unmarshal(ex.payloads["cancel"], p); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := p.Nonce, 5000; was != exp {
+		t.Errorf("nonce after resync should be %v, was: %v", exp, was)
+	}
+}
+
 func TestContractAddress(t *testing.T) {
-	mockResponse(http.StatusOK, fileBytes("contractAddress.json"))
-	idex := New()
+	idex := New(mockResponse(http.StatusOK, fileBytes("contractAddress.json")))
 
 	a, err := idex.API.ContractAddress()
 	if err != nil {
@@ -403,18 +1133,548 @@ func TestContractAddress(t *testing.T) {
 	}
 }
 
-func TestProcessTradesInserted(t *testing.T) {
-	c := make(chan SocketResponse)
-	go processTradesInserted(fileBytes("notifyTradesInserted.json"), c)
+// exchange answers the endpoints trading relies on, recording the payloads
+// sent to the others
+type exchange struct {
+	payloads map[string][]byte
+	replies  map[string][]byte
+}
 
-	r := <-c
-	if r.Error != nil {
-		t.Errorf("should not be an error: %v", r.Error)
-	}
-	if r.TradeInserted == nil {
-		t.Error("should be a TradeInserted")
+func newExchange() *exchange {
+	return &exchange{
+		payloads: map[string][]byte{},
+		replies: map[string][]byte{
+			"returnCurrencies":      fileBytes("currencies.json"),
+			"returnContractAddress": fileBytes("contractAddress.json"),
+			"returnNextNonce":       fileBytes("nextNonce.json"),
+			"returnTicker":          []byte(`{"ETH_PLU":{"last":"0.01"}}`),
+		},
 	}
-	if was, exp := r.TradeInserted.Price, "0.000002117466563483"; was != exp {
+}
+
+func (e *exchange) Do(req *http.Request) (*http.Response, error) {
+	endpoint := strings.TrimPrefix(req.URL.Path, "/")
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	e.payloads[endpoint] = b
+
+	if r, ok := e.replies[endpoint]; ok {
+		return response(http.StatusOK, r), nil
+	}
+	return response(http.StatusOK, []byte("{}")), nil
+}
+
+const testKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+func TestOrder(t *testing.T) {
+	key, err := crypto.HexToECDSA(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+
+	ex := newExchange()
+	ex.replies["order"] = []byte(`{"orderNumber":2101,"orderHash":"0x3fe808be7b5df3747e5534056e9ff45ead5b1fcace430d7b4092e5fcd7161e21","price":"0.01","amount":"1000","total":"10","type":"buy"}`)
+	idex := New(WithHTTPClient(ex), WithAPIURL("http://idex"), WithPrivateKey(key))
+
+	o, err := idex.API.Order("ETH_PLU", Buy, MustDecimal("0.01"), MustDecimal("1000"), 100000)
+	if err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := o.OrderNumber, 2101; was != exp {
+		t.Errorf("order number should be %v, was: %v", exp, was)
+	}
+	if was, exp := o.Market, "ETH_PLU"; was != exp {
+		t.Errorf("market should be %v, was: %v", exp, was)
+	}
+
+	p := &struct {
+		orderPayload
+		Signature
+	}{}
+	if err := json.Unmarshal(ex.payloads["order"], p); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := p.TokenBuy, "0xd8912c10681d8b21fd3742244f44658dba12264e"; was != exp {
+		t.Errorf("token buy should be %v, was: %v", exp, was)
+	}
+	if was, exp := p.AmountBuy.String(), "1000000000000000000000"; was != exp {
+		t.Errorf("amount buy should be %v, was: %v", exp, was)
+	}
+	if was, exp := p.AmountSell.String(), "10000000000000000000"; was != exp {
+		t.Errorf("amount sell should be %v, was: %v", exp, was)
+	}
+	if was, exp := p.Nonce, 2468; was != exp {
+		t.Errorf("nonce should be %v, was: %v", exp, was)
+	}
+
+	hash, err := orderHash("0x2a0c0dbecc7e4d658f48e01e3fa353f44050c208", &Params{
+		TokenBuy:   p.TokenBuy,
+		AmountBuy:  p.AmountBuy,
+		TokenSell:  p.TokenSell,
+		AmountSell: p.AmountSell,
+		Expires:    p.Expires,
+		Nonce:      p.Nonce,
+		User:       p.Address,
+	})
+	if err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	signer, err := recoverSigner(hash, &p.Signature)
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if signer != user {
+		t.Errorf("order should be signed by %v, was: %v", user, signer)
+	}
+
+	idex = New(WithHTTPClient(ex), WithAPIURL("http://idex"))
+	if _, err := idex.API.Order("ETH_PLU", Buy, MustDecimal("0.01"), MustDecimal("1000"), 100000); !errors.Is(err, ErrNoKey) {
+		t.Errorf("should be a no key error, was: %v", err)
+	}
+}
+
+func testBook() *OrderBook {
+	eth := "0x0000000000000000000000000000000000000000"
+	plu := "0xd8912c10681d8b21fd3742244f44658dba12264e"
+	return &OrderBook{
+		Asks: []Order{
+			{
+				Price: MustDecimal("0.01"), Amount: MustDecimal("100"), Total: MustDecimal("1"),
+				OrderHash: "0x1f074c92c4fa39b682c2c5c3e0d07ce8fd05d24f42b8e6c96d47dd7182986730",
+				Params:    &Params{TokenBuy: eth, AmountBuy: MustDecimal("2000000000000000000"), TokenSell: plu, AmountSell: MustDecimal("200000000000000000000")},
+			},
+			{
+				Price: MustDecimal("0.02"), Amount: MustDecimal("50"), Total: MustDecimal("1"),
+				OrderHash: "0x2f074c92c4fa39b682c2c5c3e0d07ce8fd05d24f42b8e6c96d47dd7182986730",
+				Params:    &Params{TokenBuy: eth, AmountBuy: MustDecimal("1000000000000000000"), TokenSell: plu, AmountSell: MustDecimal("50000000000000000000")},
+			},
+		},
+		Bids: []Order{
+			{
+				Price: MustDecimal("0.005"), Amount: MustDecimal("10"), Total: MustDecimal("0.05"),
+				OrderHash: "0x3f074c92c4fa39b682c2c5c3e0d07ce8fd05d24f42b8e6c96d47dd7182986730",
+				Params:    &Params{TokenBuy: plu, AmountBuy: MustDecimal("10000000000000000000"), TokenSell: eth, AmountSell: MustDecimal("50000000000000000")},
+			},
+		},
+	}
+}
+
+func TestSweep(t *testing.T) {
+	book := testBook()
+
+	fills := Sweep(book, Buy, MustDecimal("0.015"), MustDecimal("500"))
+	if was, exp := len(fills), 1; was != exp {
+		t.Fatalf("there should be %v fill, was: %v", exp, was)
+	}
+	if was, exp := fills[0].Amount.String(), "100"; was != exp {
+		t.Errorf("fill should take the whole order of %v, was: %v", exp, was)
+	}
+
+	fills = Sweep(book, Buy, MustDecimal("0.02"), MustDecimal("120"))
+	if was, exp := len(fills), 2; was != exp {
+		t.Fatalf("there should be %v fills, was: %v", exp, was)
+	}
+	if was, exp := fills[1].Amount.String(), "20"; was != exp {
+		t.Errorf("second fill should take %v, was: %v", exp, was)
+	}
+
+	if fills = Sweep(book, Sell, MustDecimal("0.006"), MustDecimal("5")); len(fills) != 0 {
+		t.Errorf("no bid should be above the limit, was: %v fills", len(fills))
+	}
+}
+
+func TestTrade(t *testing.T) {
+	key, err := crypto.HexToECDSA(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+
+	ex := newExchange()
+	ex.replies["trade"] = fileBytes("orderTrades.json")
+	idex := New(WithHTTPClient(ex), WithAPIURL("http://idex"), WithPrivateKey(key))
+	book := testBook()
+
+	fills := []Fill{
+		{Order: &book.Asks[0], Amount: MustDecimal("50")},
+		{Order: &book.Bids[0], Amount: MustDecimal("10")},
+	}
+	ts, err := idex.API.Trade(fills)
+	if err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := len(ts), 1; was != exp {
+		t.Errorf("there should be %v trade, was: %v", exp, was)
+	}
+
+	var ps []struct {
+		tradePayload
+		Signature
+	}
+	if err := json.Unmarshal(ex.payloads["trade"], &ps); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := len(ps), 2; was != exp {
+		t.Fatalf("there should be %v trades sent, was: %v", exp, was)
+	}
+	// half of the ask, paid in ETH at the order's rate
+	if was, exp := ps[0].Amount.String(), "500000000000000000"; was != exp {
+		t.Errorf("first amount should be %v, was: %v", exp, was)
+	}
+	// the bid buys PLU, so the amount stays in PLU
+	if was, exp := ps[1].Amount.String(), "10000000000000000000"; was != exp {
+		t.Errorf("second amount should be %v, was: %v", exp, was)
+	}
+	if ps[0].Nonce != 2468 || ps[1].Nonce != 2469 {
+		t.Errorf("nonces should be 2468 and 2469, were: %v and %v", ps[0].Nonce, ps[1].Nonce)
+	}
+
+	h, _ := packBytes32(ps[0].OrderHash)
+	amount, _ := packDecimal(ps[0].Amount)
+	addr, _ := packAddress(user)
+	nonce, _ := packUint256(big.NewInt(int64(ps[0].Nonce)))
+	signer, err := recoverSigner(soliditySHA3(h, amount, addr, nonce), &ps[0].Signature)
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if signer != user {
+		t.Errorf("trade should be signed by %v, was: %v", user, signer)
+	}
+
+	_, err = idex.API.Trade([]Fill{{Order: &book.Asks[1], Amount: MustDecimal("51")}})
+	if err == nil {
+		t.Error("filling more than the order has left should be an error")
+	}
+
+	// each fill fits, together they don't
+	delete(ex.payloads, "trade")
+	_, err = idex.API.Trade([]Fill{{Order: &book.Asks[1], Amount: MustDecimal("30")}, {Order: &book.Asks[1], Amount: MustDecimal("30")}})
+	if err == nil {
+		t.Error("fills of the same order adding up to more than it has left should be an error")
+	}
+	if _, ok := ex.payloads["trade"]; ok {
+		t.Error("refused trades should not be sent")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	key, err := crypto.HexToECDSA(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+	hash := "0x1f074c92c4fa39b682c2c5c3e0d07ce8fd05d24f42b8e6c96d47dd7182986730"
+
+	ex := newExchange()
+	ex.replies["cancel"] = []byte(`{"success":1}`)
+	idex := New(WithHTTPClient(ex), WithAPIURL("http://idex"), WithPrivateKey(key))
+
+	res, err := idex.API.Cancel(hash)
+	if err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := res.Status, Cancelled; was != exp {
+		t.Errorf("status should be %v, was: %v", exp, was)
+	}
+
+	p := &struct {
+		cancelPayload
+		Signature
+	}{}
+	if err := json.Unmarshal(ex.payloads["cancel"], p); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	h, _ := packBytes32(hash)
+	nonce, _ := packUint256(big.NewInt(int64(p.Nonce)))
+	signer, err := recoverSigner(soliditySHA3(h, nonce), &p.Signature)
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if signer != user || p.Address != user {
+		t.Errorf("cancel should be signed by %v, was: %v", user, signer)
+	}
+
+	ex.replies["cancel"] = []byte(`{"error":"Order already filled"}`)
+	if res, err = idex.API.Cancel(hash); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := res.Status, CancelAlreadyFilled; was != exp {
+		t.Errorf("status should be %v, was: %v", exp, was)
+	}
+
+	ex.replies["cancel"] = []byte(`{"error":"Order not found"}`)
+	if res, err = idex.API.Cancel(hash); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := res.Status, CancelUnknownOrder; was != exp {
+		t.Errorf("status should be %v, was: %v", exp, was)
+	}
+
+	// ambiguous, the order is gone but not known to be filled
+	ex.replies["cancel"] = []byte(`{"error":"Order not found or already filled"}`)
+	if res, err = idex.API.Cancel(hash); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := res.Status, CancelUnknownOrder; was != exp {
+		t.Errorf("status should be %v, was: %v", exp, was)
+	}
+
+	for _, msg := range []string{"Order partially filled", "Order is unfilled"} {
+		if err := (&APIError{Message: msg}); errors.Is(err, ErrOrderFilled) {
+			t.Errorf("%q should not be an order filled error", msg)
+		}
+	}
+
+	ex.replies["cancel"] = []byte(`{"error":"Invalid signature"}`)
+	if _, err = idex.API.Cancel(hash); err == nil {
+		t.Error("should be an error")
+	}
+
+	if _, err = idex.API.Cancel("0x1234"); err == nil {
+		t.Error("should be an error")
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	key, err := crypto.HexToECDSA(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+
+	ex := newExchange()
+	ex.replies["returnCompleteBalances"] = fileBytes("completeBalances.json")
+	ex.replies["withdraw"] = []byte(`{"amount":"0.5"}`)
+	idex := New(WithHTTPClient(ex), WithAPIURL("http://idex"), WithPrivateKey(key))
+
+	if err := idex.API.Withdraw("ETH", MustDecimal("0.5")); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+
+	p := &struct {
+		withdrawPayload
+		Signature
+	}{}
+	if err := json.Unmarshal(ex.payloads["withdraw"], p); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := p.Amount.String(), "500000000000000000"; was != exp {
+		t.Errorf("amount should be %v, was: %v", exp, was)
+	}
+	if was, exp := p.Token, "0x0000000000000000000000000000000000000000"; was != exp {
+		t.Errorf("token should be %v, was: %v", exp, was)
+	}
+
+	c, _ := packAddress("0x2a0c0dbecc7e4d658f48e01e3fa353f44050c208")
+	tok, _ := packAddress(p.Token)
+	amt, _ := packDecimal(p.Amount)
+	addr, _ := packAddress(user)
+	nonce, _ := packUint256(big.NewInt(int64(p.Nonce)))
+	signer, err := recoverSigner(soliditySHA3(c, tok, amt, addr, nonce), &p.Signature)
+	if err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if signer != user {
+		t.Errorf("withdrawal should be signed by %v, was: %v", user, signer)
+	}
+
+	// 0.987654321 ETH available
+	delete(ex.payloads, "withdraw")
+	if err := idex.API.Withdraw("ETH", MustDecimal("1")); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("should be an insufficient balance error, was: %v", err)
+	}
+	if err := idex.API.Withdraw("PLU", MustDecimal("1")); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("should be an insufficient balance error, was: %v", err)
+	}
+	// ETH has 18 decimals, a 19th would be silently dropped
+	if err := idex.API.Withdraw("ETH", MustDecimal("0.1000000000000000001")); err == nil || !strings.Contains(err.Error(), "decimals") {
+		t.Errorf("should be a too many decimals error, was: %v", err)
+	}
+	if _, ok := ex.payloads["withdraw"]; ok {
+		t.Error("refused withdrawals should not be sent")
+	}
+}
+
+func TestKeystoreSigner(t *testing.T) {
+	s, err := NewKeystoreSigner(fileBytes("keystore.json"), "idex test")
+	if err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if was, exp := s.Address(), "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"; was != exp {
+		t.Errorf("address should be %v, was: %v", exp, was)
+	}
+
+	raw, err := NewKeySignerFromHex("0x" + testKey)
+	if err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if raw.Address() != s.Address() {
+		t.Errorf("keystore and raw key addresses should match, were: %v and %v", s.Address(), raw.Address())
+	}
+
+	hash := crypto.Keccak256([]byte("idex"))
+	sig, err := sign(s, hash)
+	if err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	if signer, err := recoverSigner(hash, sig); err != nil || signer != s.Address() {
+		t.Errorf("hash should be signed by %v, was: %v, %v", s.Address(), signer, err)
+	}
+
+	if _, err := NewKeystoreSigner(fileBytes("keystore.json"), "wrong"); err == nil {
+		t.Error("should be an error")
+	}
+}
+
+// remoteSigner stands in for a signer the package knows nothing about
+type remoteSigner struct {
+	*KeySigner
+	calls int
+}
+
+func (r *remoteSigner) SignHash(hash []byte) ([]byte, error) {
+	r.calls++
+	return r.KeySigner.SignHash(hash)
+}
+
+func TestCustomSigner(t *testing.T) {
+	ks, err := NewKeySignerFromHex(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &remoteSigner{KeySigner: ks}
+
+	ex := newExchange()
+	ex.replies["cancel"] = []byte(`{"success":1}`)
+	idex := New(WithHTTPClient(ex), WithAPIURL("http://idex"), WithSigner(rs))
+
+	if _, err := idex.API.Cancel("0x1f074c92c4fa39b682c2c5c3e0d07ce8fd05d24f42b8e6c96d47dd7182986730"); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if was, exp := rs.calls, 1; was != exp {
+		t.Errorf("signer should be called %v time, was: %v", exp, was)
+	}
+}
+
+func TestNewOrderParams(t *testing.T) {
+	eth := &Token{Symbol: "ETH", Address: "0x0000000000000000000000000000000000000000", Decimals: 18}
+	tok := &Token{Symbol: "TOK", Address: "0x1111111111111111111111111111111111111111", Decimals: 2}
+	// 3.33 TOK, after truncating, at 1.3 wei each is 4.329 wei
+	price, quantity := MustDecimal("0.0000000000000000013"), MustDecimal("3.339")
+
+	tests := []struct {
+		side       Side
+		amountBuy  string
+		amountSell string
+	}{
+		{Buy, "333", "4"},
+		{Sell, "5", "333"},
+	}
+	for _, test := range tests {
+		p, err := NewOrderParams(eth, tok, test.side, price, quantity)
+		if err != nil {
+			t.Fatalf("should not be an error: %v", err)
+		}
+		if was, exp := p.AmountBuy.String(), test.amountBuy; was != exp {
+			t.Errorf("%v amount buy should be %v, was: %v", test.side, exp, was)
+		}
+		if was, exp := p.AmountSell.String(), test.amountSell; was != exp {
+			t.Errorf("%v amount sell should be %v, was: %v", test.side, exp, was)
+		}
+
+		side, pr, q, err := p.PriceQuantity(eth, tok)
+		if err != nil {
+			t.Fatalf("should not be an error: %v", err)
+		}
+		if side != test.side || !q.Equal(MustDecimal("3.33")) {
+			t.Errorf("should be a %v of 3.33, was: %v of %v", test.side, side, q)
+		}
+
+		again, err := NewOrderParams(eth, tok, side, pr, q)
+		if err != nil {
+			t.Fatalf("should not be an error: %v", err)
+		}
+		if !again.AmountBuy.Equal(p.AmountBuy) || !again.AmountSell.Equal(p.AmountSell) {
+			t.Errorf("%v should round trip to %v/%v, was: %v/%v", test.side, p.AmountBuy, p.AmountSell, again.AmountBuy, again.AmountSell)
+		}
+	}
+
+	// a token without decimals needs more places for the price to round trip
+	whole := &Token{Symbol: "WHL", Address: "0x2222222222222222222222222222222222222222", Decimals: 0}
+	for _, side := range []Side{Buy, Sell} {
+		p, err := NewOrderParams(eth, whole, side, MustDecimal("0.1234567890123456789"), MustDecimal("7"))
+		if err != nil {
+			t.Fatalf("should not be an error: %v", err)
+		}
+		_, pr, q, err := p.PriceQuantity(eth, whole)
+		if err != nil {
+			t.Fatalf("should not be an error: %v", err)
+		}
+		again, err := NewOrderParams(eth, whole, side, pr, q)
+		if err != nil {
+			t.Fatalf("should not be an error: %v", err)
+		}
+		if !again.AmountBuy.Equal(p.AmountBuy) || !again.AmountSell.Equal(p.AmountSell) {
+			t.Errorf("%v of a whole token should round trip to %v/%v, was: %v/%v", side, p.AmountBuy, p.AmountSell, again.AmountBuy, again.AmountSell)
+		}
+	}
+
+	if _, err := NewOrderParams(eth, tok, Buy, price, MustDecimal("0.001")); err == nil {
+		t.Error("should be an error")
+	}
+	if _, _, _, err := (&Params{TokenBuy: eth.Address, TokenSell: eth.Address}).PriceQuantity(eth, tok); err == nil {
+		t.Error("should be an error")
+	}
+}
+
+func TestOrderHash(t *testing.T) {
+	// packing matches web3.utils.soliditySha3 over the same values
+	hash, err := orderHash("0x2a0c0dbecc7e4d658f48e01e3fa353f44050c208", &Params{
+		TokenBuy:   "0x0000000000000000000000000000000000000000",
+		AmountBuy:  MustDecimal("1"),
+		TokenSell:  "0xd8912c10681d8b21fd3742244f44658dba12264e",
+		AmountSell: MustDecimal("2"),
+		Expires:    3,
+		Nonce:      4,
+		User:       "0x0000000000000000000000000000000000000005",
+	})
+	if err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	packed := "2a0c0dbecc7e4d658f48e01e3fa353f44050c208" +
+		"0000000000000000000000000000000000000000" +
+		fmt.Sprintf("%064x", 1) +
+		"d8912c10681d8b21fd3742244f44658dba12264e" +
+		fmt.Sprintf("%064x", 2) +
+		fmt.Sprintf("%064x", 3) +
+		fmt.Sprintf("%064x", 4) +
+		"0000000000000000000000000000000000000005"
+	b, _ := hex.DecodeString(packed)
+	if was, exp := hex.EncodeToString(hash), hex.EncodeToString(crypto.Keccak256(b)); was != exp {
+		t.Errorf("order hash should be %v, was: %v", exp, was)
+	}
+
+	if _, err := orderHash("0x2a0c", &Params{}); err == nil {
+		t.Error("should be an error")
+	}
+}
+
+func TestProcessTradesInserted(t *testing.T) {
+	c := make(chan SocketResponse)
+	s := &Socket{}
+	go s.processTradesInserted(context.Background(), fileBytes("notifyTradesInserted.json"), c)
+
+	r := <-c
+	if r.Error != nil {
+		t.Errorf("should not be an error: %v", r.Error)
+	}
+	if r.TradeInserted == nil {
+		t.Error("should be a TradeInserted")
+	}
+	if was, exp := r.TradeInserted.Price.String(), "0.000002117466563483"; was != exp {
 		t.Errorf("inserted trade price should be %v, was: %v", exp, was)
 	}
 	if was, exp := r.TradeInserted.V, 27; was != exp {
@@ -428,7 +1688,7 @@ func TestProcessTradesInserted(t *testing.T) {
 	if r.TradeInserted == nil {
 		t.Error("should be a TradeInserted")
 	}
-	if was, exp := r.TradeInserted.Price, "0.000002118000000000"; was != exp {
+	if was, exp := r.TradeInserted.Price.String(), "0.000002118000000000"; was != exp {
 		t.Errorf("inserted trade price should be %v, was: %v", exp, was)
 	}
 	// this case tests for when V comes back as a string instead of an int
@@ -439,7 +1699,8 @@ func TestProcessTradesInserted(t *testing.T) {
 
 func TestProcessOrderInserted(t *testing.T) {
 	c := make(chan SocketResponse)
-	go processOrderInserted(fileBytes("notifyOrderInserted.json"), c)
+	s := &Socket{}
+	go s.processOrderInserted(context.Background(), fileBytes("notifyOrderInserted.json"), c)
 
 	r := <-c
 	if r.Error != nil {
@@ -456,7 +1717,7 @@ func TestProcessOrderInserted(t *testing.T) {
 	}
 
 	// this file has V as a string
-	go processOrderInserted(fileBytes("notifyOrderInserted2.json"), c)
+	go s.processOrderInserted(context.Background(), fileBytes("notifyOrderInserted2.json"), c)
 
 	r = <-c
 	if r.Error != nil {
@@ -469,7 +1730,8 @@ func TestProcessOrderInserted(t *testing.T) {
 
 func TestProcessPushCancel(t *testing.T) {
 	c := make(chan SocketResponse)
-	go processPushCancel(fileBytes("notifyPushCancel.json"), c)
+	s := &Socket{}
+	go s.processPushCancel(context.Background(), fileBytes("notifyPushCancel.json"), c)
 
 	r := <-c
 	if r.Error != nil {
@@ -486,7 +1748,7 @@ func TestProcessPushCancel(t *testing.T) {
 	}
 
 	// this file has V as a string
-	go processPushCancel(fileBytes("notifyPushCancel2.json"), c)
+	go s.processPushCancel(context.Background(), fileBytes("notifyPushCancel2.json"), c)
 
 	r = <-c
 	if r.Error != nil {
@@ -502,7 +1764,8 @@ func TestProcessPushCancel(t *testing.T) {
 
 func TestProcessPushCancels(t *testing.T) {
 	c := make(chan SocketResponse)
-	go processPushCancels(fileBytes("notifyPushCancels.json"), c)
+	s := &Socket{}
+	go s.processPushCancels(context.Background(), fileBytes("notifyPushCancels.json"), c)
 
 	r := <-c
 	if r.Error != nil {
@@ -527,3 +1790,559 @@ func TestProcessPushCancels(t *testing.T) {
 	}
 
 }
+
+func TestVerifyEvents(t *testing.T) {
+	c := make(chan SocketResponse)
+	s := &Socket{Verify: VerifyMark}
+
+	// recorded from IDEX, so the signatures are genuine
+	go s.processOrderInserted(context.Background(), fileBytes("notifyOrderInserted.json"), c)
+	r := <-c
+	if r.VerifyError != nil {
+		t.Errorf("order should verify: %v", r.VerifyError)
+	}
+
+	go s.processTradesInserted(context.Background(), fileBytes("notifyTradesInserted.json"), c)
+	r = <-c
+	if r.VerifyError != nil {
+		t.Errorf("trade should verify: %v", r.VerifyError)
+	}
+	// the second trade was edited
+	r = <-c
+	if !errors.Is(r.VerifyError, ErrBadSignature) {
+		t.Errorf("edited trade should fail verification, was: %v", r.VerifyError)
+	}
+
+	forged := *r.TradeInserted
+	forged.User = "0x0000000000000000000000000000000000000001"
+	if err := VerifyTradeInserted(&forged); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("should be a bad signature error, was: %v", err)
+	}
+
+	o := &OrderInserted{}
+	go s.processOrderInserted(context.Background(), fileBytes("notifyOrderInserted.json"), c)
+	*o = *(<-c).OrderInserted
+	o.AmountSell = o.AmountSell.Add(MustDecimal("1"))
+	if err := VerifyOrderInserted(o, DefaultContractAddress); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("should be a bad signature error, was: %v", err)
+	}
+
+	// dropped events never reach the channel
+	s.Verify = VerifyDrop
+	go func() {
+		s.processTradesInserted(context.Background(), fileBytes("notifyTradesInserted.json"), c)
+		close(c)
+	}()
+	count := 0
+	for range c {
+		count++
+	}
+	if was, exp := count, 1; was != exp {
+		t.Errorf("there should be %v verified trade, was: %v", exp, was)
+	}
+}
+
+func TestProcessServerPushes(t *testing.T) {
+	c := make(chan SocketResponse)
+	s := &Socket{}
+	if s.EthPrice().Valid() || s.ServerBlock() != 0 || s.RewardPoolSize().Valid() {
+		t.Error("pushed values should be unset before any push")
+	}
+
+	go s.processEthPrice(context.Background(), fileBytes("pushEthPrice.json"), c)
+	r := <-c
+	if r.Error != nil || r.EthPrice == nil {
+		t.Fatalf("should be an EthPrice, was: %+v", r)
+	}
+	if was, exp := s.EthPrice().String(), "285.31"; was != exp || r.EthPrice.USD.String() != exp {
+		t.Errorf("eth price should be %v, was: %v", exp, was)
+	}
+
+	go s.processServerBlock(context.Background(), fileBytes("pushServerBlock.json"), c)
+	r = <-c
+	if r.Error != nil || r.ServerBlock == nil {
+		t.Fatalf("should be a ServerBlock, was: %+v", r)
+	}
+	if was, exp := s.ServerBlock(), int64(6248651); was != exp {
+		t.Errorf("server block should be %v, was: %v", exp, was)
+	}
+	go s.processServerBlock(context.Background(), []byte(`{"method":"pushServerBlock","payload":"6248650"}`), c)
+	<-c
+	if was, exp := s.ServerBlock(), int64(6248651); was != exp {
+		t.Errorf("server block should stay at %v, was: %v", exp, was)
+	}
+
+	go s.processRewardPoolSize(context.Background(), fileBytes("pushRewardPoolSize.json"), c)
+	r = <-c
+	if r.Error != nil || r.RewardPoolSize == nil {
+		t.Fatalf("should be a RewardPoolSize, was: %+v", r)
+	}
+	if was, exp := s.RewardPoolSize().String(), "16328.291245"; was != exp {
+		t.Errorf("reward pool size should be %v, was: %v", exp, was)
+	}
+
+	go s.processEthPrice(context.Background(), []byte(`{"method":"pushEthPrice"}`), c)
+	if r := <-c; r.Error == nil {
+		t.Error("should be an error")
+	}
+}
+
+func TestVerifyTradeInsertedParties(t *testing.T) {
+	p := &struct {
+		Payload []*TradeInserted `json:"payload"`
+	}{}
+	if err := json.Unmarshal(fileBytes("notifyTradesInserted.json"), p); err != nil {
+		t.Fatal(err)
+	}
+	tr := p.Payload[0]
+	if err := VerifyTradeInserted(tr); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+
+	tr.Buy = "0x0000000000000000000000000000000000000001"
+	if err := VerifyTradeInserted(tr); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("a trade whose user isn't a side should be a bad signature, was: %v", err)
+	}
+}
+
+func TestVerifyPushCancel(t *testing.T) {
+	key, err := crypto.HexToECDSA(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := "0x216a8e0de8c3fc08279e0fccee5b9da7011312dab4b740288729f4f77497cbaa"
+	h, _ := packBytes32(hash)
+	n, _ := packUint256(big.NewInt(7))
+	sig, err := sign(NewKeySigner(key), soliditySHA3(h, n))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &PushCancel{
+		Hash: hash,
+		User: crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		V:    sig.V,
+		R:    sig.R,
+		S:    sig.S,
+	}
+	if err := VerifyPushCancel(c, 7); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	if err := VerifyPushCancel(c, 8); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("should be a bad signature error, was: %v", err)
+	}
+}
+
+// socketServer runs conns[i] for the i-th websocket connection, after reading
+// its handshake, and counts handshakes
+type socketServer struct {
+	*httptest.Server
+	mu         sync.Mutex
+	handshakes int
+	// handshake and header of the last connection
+	handshake []byte
+	header    http.Header
+}
+
+func newSocketServer(conns ...func(c *websocket.Conn)) *socketServer {
+	ss := &socketServer{}
+	up := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	ss.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		_, msg, err := c.ReadMessage()
+		if err != nil || !bytes.Contains(msg, []byte(`"handshake"`)) {
+			return
+		}
+		ss.mu.Lock()
+		n := ss.handshakes
+		ss.handshakes++
+		ss.handshake, ss.header = msg, r.Header
+		ss.mu.Unlock()
+
+		if n < len(conns) {
+			conns[n](c)
+		}
+	}))
+	return ss
+}
+
+func (ss *socketServer) url() string {
+	return "ws" + strings.TrimPrefix(ss.URL, "http")
+}
+
+// echoClose waits for the client's close frame and answers it
+func echoClose(c *websocket.Conn) {
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func TestSocketReconnect(t *testing.T) {
+	ss := newSocketServer(
+		func(c *websocket.Conn) {
+			// drop the connection without a close frame
+			c.UnderlyingConn().Close()
+		},
+		func(c *websocket.Conn) {
+			c.WriteMessage(websocket.TextMessage, fileBytes("notifyOrderInserted.json"))
+			echoClose(c)
+		},
+	)
+	defer ss.Close()
+
+	s := &Socket{URL: ss.url(), Reconnect: &ReconnectPolicy{BaseDelay: time.Millisecond}}
+	if err := s.Connect(); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+
+	c := make(chan SocketResponse)
+	done := make(chan struct{})
+	go func() {
+		s.Monitor(c)
+		close(done)
+	}()
+
+	r := <-c
+	if r.Connection == nil || r.Connection.State != Disconnected || r.Connection.Err == nil {
+		t.Fatalf("should be a disconnection, was: %+v", r)
+	}
+	r = <-c
+	if r.Connection == nil || r.Connection.State != Reconnected || r.Connection.Attempt != 1 {
+		t.Fatalf("should be reconnected on the first attempt, was: %+v", r)
+	}
+	r = <-c
+	if r.OrderInserted == nil {
+		t.Fatalf("should be an OrderInserted, was: %+v", r)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Errorf("should not be an error: %v", err)
+	}
+	select {
+	case r, ok := <-c:
+		if ok {
+			t.Errorf("should not reconnect once closed, got: %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Error("monitor should return once closed")
+	}
+	<-done
+	if was, exp := ss.handshakes, 2; was != exp {
+		t.Errorf("there should be %v handshakes, was: %v", exp, was)
+	}
+}
+
+func TestSocketReconnectGivesUp(t *testing.T) {
+	ss := newSocketServer(func(c *websocket.Conn) {
+		c.UnderlyingConn().Close()
+	})
+
+	s := &Socket{URL: ss.url(), Reconnect: &ReconnectPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}}
+	if err := s.Connect(); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+	ss.Close()
+
+	c := make(chan SocketResponse, 10)
+	s.Monitor(c)
+
+	var states []ConnectionState
+	var last SocketResponse
+	for r := range c {
+		if r.Connection != nil {
+			states = append(states, r.Connection.State)
+		}
+		last = r
+	}
+	if was, exp := fmt.Sprint(states), fmt.Sprint([]ConnectionState{Disconnected, ReconnectFailed, ReconnectFailed}); was != exp {
+		t.Errorf("connection events should be %v, were: %v", exp, was)
+	}
+	if last.Error == nil || !strings.Contains(last.Error.Error(), "gave up") {
+		t.Errorf("should end with giving up, was: %+v", last)
+	}
+}
+
+func TestMonitorContext(t *testing.T) {
+	closed := make(chan int, 1)
+	ss := newSocketServer(func(c *websocket.Conn) {
+		c.SetCloseHandler(func(code int, text string) error {
+			closed <- code
+			return c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+		})
+		c.WriteMessage(websocket.TextMessage, fileBytes("notifyOrderInserted.json"))
+		echoClose(c)
+	})
+	defer ss.Close()
+
+	s := &Socket{URL: ss.url()}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.ConnectContext(ctx); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+
+	c := make(chan SocketResponse)
+	done := make(chan error)
+	go func() {
+		done <- s.MonitorContext(ctx, c)
+	}()
+
+	// the order event is never read, cancelling should still get through
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("should be a cancelled error, was: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("monitor should return once cancelled")
+	}
+	select {
+	case code := <-closed:
+		if code != websocket.CloseNormalClosure {
+			t.Errorf("close code should be %v, was: %v", websocket.CloseNormalClosure, code)
+		}
+	default:
+		t.Error("server should get a close frame")
+	}
+	if _, ok := <-c; ok {
+		t.Error("response channel should be closed")
+	}
+}
+
+func TestConnectContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := &Socket{URL: "ws://idex.invalid"}
+	if err := s.ConnectContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("should be a cancelled error, was: %v", err)
+	}
+}
+
+func TestHandshakeOptions(t *testing.T) {
+	ss := newSocketServer(func(c *websocket.Conn) {
+		c.WriteMessage(websocket.TextMessage, []byte(`{"method":"handshake","result":"success","payload":{"type":"server","version":"2.1"}}`))
+		echoClose(c)
+	})
+	defer ss.Close()
+
+	s := &Socket{
+		URL:     ss.url(),
+		Key:     "my-key",
+		Version: "2.1",
+		Dialer:  &websocket.Dialer{HandshakeTimeout: time.Second},
+		Header:  http.Header{"Origin": []string{"https://example.com"}},
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+
+	c := make(chan SocketResponse)
+	go s.Monitor(c)
+
+	r := <-c
+	if r.Handshake == nil || r.Handshake.Rejected() {
+		t.Errorf("handshake should be accepted, was: %+v", r.Handshake)
+	} else if was, exp := r.Handshake.Version, "2.1"; was != exp {
+		t.Errorf("server version should be %v, was: %v", exp, was)
+	}
+	s.Close()
+	for range c {
+	}
+
+	if !bytes.Contains(ss.handshake, []byte(`"version":"2.1","key":"my-key"`)) {
+		t.Errorf("handshake should have the key and version, was: %s", ss.handshake)
+	}
+	if was, exp := ss.header.Get("Origin"), "https://example.com"; was != exp {
+		t.Errorf("origin header should be %v, was: %v", exp, was)
+	}
+}
+
+func TestParseHandshake(t *testing.T) {
+	tests := []struct {
+		msg      string
+		rejected bool
+		version  string
+		message  string
+	}{
+		{`{"method":"handshake","result":"success","payload":"{\"type\":\"server\",\"version\":\"2.0\"}"}`, false, "2.0", ""},
+		{`{"method":"handshake","result":"success","payload":"welcome"}`, false, "", ""},
+		{`{"method":"handshake","payload":{"type":"server","version":"2.0"}}`, false, "2.0", ""},
+		{`{"method":"handshake","result":"error","payload":"invalid key"}`, true, "", "invalid key"},
+		{`{"method":"handshake","error":"invalid version"}`, true, "", "invalid version"},
+	}
+	for _, test := range tests {
+		h, err := parseHandshake([]byte(test.msg))
+		if err != nil {
+			t.Fatalf("should not be an error: %v", err)
+		}
+		if h.Rejected() != test.rejected || h.Version != test.version || h.Message != test.message {
+			t.Errorf("%s should be rejected %v, version %q and message %q, was: %+v", test.msg, test.rejected, test.version, test.message, h)
+		}
+	}
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	ss := newSocketServer(func(c *websocket.Conn) {
+		c.WriteMessage(websocket.TextMessage, []byte(`{"method":"handshake","result":"error","payload":"invalid key"}`))
+		echoClose(c)
+	})
+	defer ss.Close()
+
+	s := &Socket{URL: ss.url(), Reconnect: &ReconnectPolicy{BaseDelay: time.Millisecond}}
+	if err := s.Connect(); err != nil {
+		t.Fatalf("should not be an error: %v", err)
+	}
+
+	c := make(chan SocketResponse, 1)
+	err := s.MonitorContext(context.Background(), c)
+	if !errors.Is(err, ErrHandshakeRejected) {
+		t.Errorf("should be a rejected handshake error, was: %v", err)
+	}
+
+	r := <-c
+	if r.Handshake == nil || !r.Handshake.Rejected() {
+		t.Fatalf("handshake should be rejected, was: %+v", r.Handshake)
+	}
+	if was, exp := r.Handshake.Message, "invalid key"; was != exp {
+		t.Errorf("rejection message should be %v, was: %v", exp, was)
+	}
+	if was, exp := ss.handshakes, 1; was != exp {
+		t.Errorf("there should be %v handshake, was: %v", exp, was)
+	}
+}
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	fast, fs := b.Trades(10)
+	slow, ss := b.Trades(1)
+	orders, _ := b.Orders(10)
+
+	var mu sync.Mutex
+	var prices []string
+	done := make(chan struct{})
+	b.OnEthPrice(1, func(p *EthPrice) {
+		mu.Lock()
+		prices = append(prices, p.USD.String())
+		mu.Unlock()
+		close(done)
+	})
+
+	in := make(chan SocketResponse)
+	go b.Run(in)
+	for i := 0; i < 3; i++ {
+		in <- SocketResponse{TradeInserted: &TradeInserted{Amount: NewDecimalFromInt(int64(i))}}
+	}
+	in <- SocketResponse{TradeInserted: &TradeInserted{}, VerifyError: ErrBadSignature}
+	in <- SocketResponse{EthPrice: &EthPrice{USD: MustDecimal("285.31")}}
+	<-done
+
+	if was, exp := len(fast), 3; was != exp {
+		t.Errorf("fast subscriber should have %v trades, had: %v", exp, was)
+	}
+	if was, exp := fs.Dropped(), uint64(0); was != exp {
+		t.Errorf("fast subscriber should drop %v trades, dropped: %v", exp, was)
+	}
+	if was, exp := ss.Dropped(), uint64(2); was != exp {
+		t.Errorf("slow subscriber should drop %v trades, dropped: %v", exp, was)
+	}
+	if tr := <-slow; !tr.Amount.IsZero() {
+		t.Errorf("slow subscriber should keep the first trade, had: %v", tr.Amount)
+	}
+	if was, exp := len(orders), 0; was != exp {
+		t.Errorf("order subscriber should have %v orders, had: %v", exp, was)
+	}
+	mu.Lock()
+	if was, exp := fmt.Sprint(prices), "[285.31]"; was != exp {
+		t.Errorf("prices should be %v, were: %v", exp, was)
+	}
+	mu.Unlock()
+
+	ss.Unsubscribe()
+	if _, ok := <-slow; ok {
+		t.Error("unsubscribed channel should be closed")
+	}
+	ss.Unsubscribe()
+
+	close(in)
+	for range fast {
+	}
+	if _, ok := <-orders; ok {
+		t.Error("channels should be closed once the bus input is")
+	}
+	cancels, _ := b.Cancels(1)
+	if _, ok := <-cancels; ok {
+		t.Error("subscribing to a closed bus should give a closed channel")
+	}
+}
+
+func TestSocketFilter(t *testing.T) {
+	ex := newExchange()
+	ex.replies["returnCurrencies"] = []byte(`{
+		"ETH":{"decimals":18,"address":"0x0000000000000000000000000000000000000000"},
+		"NPXS":{"decimals":18,"address":"0x9a0242b7a33dacbe40edb927834f96eb39f8fbcb"}
+	}`)
+	ex.replies["returnTicker"] = []byte(`{"ETH_NPXS":{"last":"0.000002"}}`)
+	idex := New(WithHTTPClient(ex), WithAPIURL("http://idex"))
+	s := idex.Socket
+
+	filter := func(f *Filter) {
+		compiled, err := compileFilter(f)
+		if err != nil {
+			t.Fatalf("should not be an error: %v", err)
+		}
+		s.Filter, s.filter = f, compiled
+	}
+	events := func(process func(context.Context, []byte, chan SocketResponse), file string) []SocketResponse {
+		c := make(chan SocketResponse, 10)
+		process(context.Background(), fileBytes(file), c)
+		close(c)
+		var rs []SocketResponse
+		for r := range c {
+			rs = append(rs, r)
+		}
+		return rs
+	}
+
+	filter(&Filter{Users: []string{"0x31F93B1D69544F4264F31914AAF151558FB12A1C"}})
+	rs := events(s.processTradesInserted, "notifyTradesInserted.json")
+	if len(rs) != 1 || rs[0].TradeInserted == nil || rs[0].TradeInserted.ID != 2212265 {
+		t.Errorf("only the trade sold by the user should pass, was: %+v", rs)
+	}
+
+	filter(&Filter{Markets: []string{"ETH_NPXS"}, MinNotional: MustDecimal("0.1")})
+	rs = events(s.processTradesInserted, "notifyTradesInserted.json")
+	if len(rs) != 1 || rs[0].TradeInserted == nil || rs[0].TradeInserted.ID != 2212263 {
+		t.Errorf("only the 0.2 ETH trade should pass, was: %+v", rs)
+	}
+
+	// the order's token is unknown, so it can't be on the market
+	if rs = events(s.processOrderInserted, "notifyOrderInserted.json"); len(rs) != 0 {
+		t.Errorf("the order should not pass, was: %+v", rs)
+	}
+
+	// markets don't apply to cancels, users do
+	filter(&Filter{Markets: []string{"ETH_NPXS"}, Users: []string{"0xbe2166684788b079680b57a6ecf3778c51c186ae"}})
+	rs = events(s.processPushCancel, "notifyPushCancel.json")
+	if len(rs) != 1 || rs[0].PushCancel == nil {
+		t.Errorf("the user's cancel should pass, was: %+v", rs)
+	}
+
+	bad := &Socket{Filter: &Filter{Markets: []string{"NPXS"}}}
+	c := make(chan SocketResponse)
+	if err := bad.MonitorContext(context.Background(), c); err == nil || !strings.Contains(err.Error(), "invalid filter") {
+		t.Errorf("should be an invalid filter error, was: %v", err)
+	}
+	if _, ok := <-c; ok {
+		t.Error("response channel should be closed")
+	}
+}
@@ -0,0 +1,176 @@
+package idex
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Market symbol in BASE_QUOTE form, e.g. "ETH_AUC" trades AUC priced in ETH
+type Market string
+
+// NewMarket from its base and quote symbols
+func NewMarket(base, quote string) Market {
+	return Market(base + "_" + quote)
+}
+
+// ParseMarket validates a BASE_QUOTE market symbol
+func ParseMarket(s string) (Market, error) {
+	parts := strings.Split(s, "_")
+	if len(parts) != 2 || !validSymbol(parts[0]) || !validSymbol(parts[1]) {
+		return "", fmt.Errorf("invalid market %q, expected BASE_QUOTE", s)
+	}
+	return Market(s), nil
+}
+
+func validSymbol(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !('A' <= r && r <= 'Z' || 'a' <= r && r <= 'z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Base symbol the market is priced in, e.g. ETH
+func (m Market) Base() string {
+	if i := strings.IndexByte(string(m), '_'); i >= 0 {
+		return string(m[:i])
+	}
+	return ""
+}
+
+// Quote symbol traded on the market, e.g. AUC
+func (m Market) Quote() string {
+	if i := strings.IndexByte(string(m), '_'); i >= 0 {
+		return string(m[i+1:])
+	}
+	return ""
+}
+
+func (m Market) String() string {
+	return string(m)
+}
+
+// Side of an order, buying or selling the quote token
+type Side string
+
+// Order sides
+const (
+	Buy  Side = "buy"
+	Sell Side = "sell"
+)
+
+// Markets lists every market, from Tickers
+func (a *API) Markets() ([]Market, error) {
+	return a.MarketsContext(context.Background())
+}
+
+// MarketsContext is like Markets but uses ctx for the request
+func (a *API) MarketsContext(ctx context.Context) ([]Market, error) {
+	tks, err := a.TickersContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := make([]Market, 0, len(tks))
+	for s := range tks {
+		m, err := ParseMarket(s)
+		if err != nil {
+			continue
+		}
+		ms = append(ms, m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i] < ms[j] })
+
+	return ms, nil
+}
+
+// MarketResolver finds the market and side of a token address pair, as found
+// on websocket events. Markets are loaded from Tickers on first use and again
+// when a pair doesn't match any.
+type MarketResolver struct {
+	Tokens *TokenRegistry
+
+	api         *API
+	mu          sync.RWMutex
+	markets     map[Market]bool
+	lastRefresh time.Time
+}
+
+// NewMarketResolver backed by the API, with its own TokenRegistry
+func NewMarketResolver(a *API) *MarketResolver {
+	return &MarketResolver{Tokens: NewTokenRegistry(a), api: a}
+}
+
+// Refresh reloads the known markets
+func (r *MarketResolver) Refresh(ctx context.Context) error {
+	ms, err := r.api.MarketsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	markets := make(map[Market]bool, len(ms))
+	for _, m := range ms {
+		markets[m] = true
+	}
+
+	r.mu.Lock()
+	r.markets = markets
+	r.lastRefresh = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Resolve the market of an order or trade from its token addresses. Buying
+// the quote token with the base token is a Buy, the other way round a Sell.
+func (r *MarketResolver) Resolve(ctx context.Context, tokenBuy, tokenSell string) (Market, Side, error) {
+	tb, err := r.Tokens.Token(ctx, tokenBuy)
+	if err != nil {
+		return "", "", err
+	}
+	ts, err := r.Tokens.Token(ctx, tokenSell)
+	if err != nil {
+		return "", "", err
+	}
+
+	buy, sell := NewMarket(ts.Symbol, tb.Symbol), NewMarket(tb.Symbol, ts.Symbol)
+	if m, s, ok := r.match(buy, sell); ok {
+		return m, s, nil
+	}
+
+	r.mu.RLock()
+	stale := time.Since(r.lastRefresh) >= minTokenRefresh
+	r.mu.RUnlock()
+
+	if stale {
+		if err := r.Refresh(ctx); err != nil {
+			return "", "", err
+		}
+		if m, s, ok := r.match(buy, sell); ok {
+			return m, s, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("%w: no market for %v and %v", ErrMarketNotFound, tb.Symbol, ts.Symbol)
+}
+
+func (r *MarketResolver) match(buy, sell Market) (Market, Side, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switch {
+	case r.markets[buy]:
+		return buy, Buy, true
+	case r.markets[sell]:
+		return sell, Sell, true
+	}
+	return "", "", false
+}
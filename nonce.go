@@ -0,0 +1,187 @@
+package idex
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// NonceStore persists the next nonce of each address across restarts
+type NonceStore interface {
+	// Load the next nonce of address, ok is false when none was saved
+	Load(address string) (nonce int, ok bool, err error)
+	// Save the next nonce of address
+	Save(address string, nonce int) error
+}
+
+// NonceManager hands out strictly increasing nonces per address, safe for
+// use from several goroutines. Each address is seeded from NextNonce, or from
+// its Store when that is further ahead.
+type NonceManager struct {
+	// Store, when set, keeps the high-water mark of every address
+	Store NonceStore
+
+	api  *API
+	mu   sync.Mutex
+	next map[string]int
+}
+
+// NewNonceManager backed by the API, store may be nil
+func NewNonceManager(a *API, store NonceStore) *NonceManager {
+	return &NonceManager{Store: store, api: a, next: map[string]int{}}
+}
+
+// Next nonce for address
+func (m *NonceManager) Next(ctx context.Context, address string) (int, error) {
+	return m.Reserve(ctx, address, 1)
+}
+
+// Reserve n consecutive nonces for address, returning the first
+func (m *NonceManager) Reserve(ctx context.Context, address string, n int) (int, error) {
+	address = strings.ToLower(address)
+
+	m.mu.Lock()
+	_, ok := m.next[address]
+	m.mu.Unlock()
+
+	// seed without the lock so a slow server only holds up this address
+	var seed int
+	if !ok {
+		var err error
+		if seed, err = m.seed(ctx, address); err != nil {
+			return 0, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// another caller may have seeded and reserved meanwhile, nonces only move forward
+	next, ok := m.next[address]
+	if !ok || seed > next {
+		next = seed
+	}
+
+	m.next[address] = next + n
+	if m.Store != nil {
+		if err := m.Store.Save(address, next+n); err != nil {
+			return 0, err
+		}
+	}
+
+	return next, nil
+}
+
+// Resync address with the server after a nonce was rejected. Nonces only move
+// forward, to whichever of the server and the manager is further ahead.
+func (m *NonceManager) Resync(ctx context.Context, address string) error {
+	address = strings.ToLower(address)
+
+	n, err := m.api.NextNonceContext(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n > m.next[address] {
+		m.next[address] = n
+		if m.Store != nil {
+			return m.Store.Save(address, n)
+		}
+	}
+	return nil
+}
+
+// seed the first nonce of address
+func (m *NonceManager) seed(ctx context.Context, address string) (int, error) {
+	n, err := m.api.NextNonceContext(ctx, address)
+	if err != nil {
+		return 0, err
+	}
+
+	if m.Store != nil {
+		stored, ok, err := m.Store.Load(address)
+		if err != nil {
+			return 0, err
+		}
+		if ok && stored > n {
+			n = stored
+		}
+	}
+
+	return n, nil
+}
+
+// FileNonceStore saves nonces as JSON in the file at Path
+type FileNonceStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Load the next nonce of address from the file
+func (s *FileNonceStore) Load(address string) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns, err := s.read()
+	if err != nil {
+		return 0, false, err
+	}
+	n, ok := ns[strings.ToLower(address)]
+	return n, ok, nil
+}
+
+// Save the next nonce of address to the file, replacing it atomically
+func (s *FileNonceStore) Save(address string, nonce int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns, err := s.read()
+	if err != nil {
+		return err
+	}
+	ns[strings.ToLower(address)] = nonce
+
+	b, err := json.Marshal(ns)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+func (s *FileNonceStore) read() (map[string]int, error) {
+	ns := map[string]int{}
+
+	b, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return ns, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &ns); err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
@@ -0,0 +1,44 @@
+package idex
+
+import "encoding/json"
+
+// Request payloads of the API endpoints, unset optional filters are omitted
+
+type marketPayload struct {
+	Market string `json:"market"`
+}
+
+type addressPayload struct {
+	Address string `json:"address"`
+}
+
+type openOrdersPayload struct {
+	Market  string `json:"market,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+type tradeHistoryPayload struct {
+	Market  string `json:"market,omitempty"`
+	Address string `json:"address,omitempty"`
+	Start   int    `json:"start,omitempty"`
+	End     int    `json:"end,omitempty"`
+}
+
+type depositsWithdrawalsPayload struct {
+	Address string `json:"address"`
+	Start   int    `json:"start,omitempty"`
+	End     int    `json:"end,omitempty"`
+}
+
+type orderTradesPayload struct {
+	OrderHash string `json:"orderHash"`
+}
+
+// encode a payload for Post
+func encode(p interface{}) (string, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
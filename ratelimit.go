@@ -0,0 +1,111 @@
+package idex
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultWeights of endpoints in tokens, heavier queries cost more
+var DefaultWeights = map[string]int{
+	"returnOrderBook":           4,
+	"returnTradeHistory":        4,
+	"returnOpenOrders":          2,
+	"returnOrderTrades":         2,
+	"returnDepositsWithdrawals": 2,
+}
+
+// RateLimiter is a token bucket shared by every request of an API
+type RateLimiter struct {
+	// Weights of endpoints in tokens, 1 when not listed
+	Weights map[string]int
+
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter refills rate tokens per second, holding at most burst, and
+// starts full with a copy of DefaultWeights
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	w := make(map[string]int, len(DefaultWeights))
+	for k, v := range DefaultWeights {
+		w[k] = v
+	}
+
+	return &RateLimiter{
+		Weights: w,
+		rate:    rate,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+	}
+}
+
+// Weight of a request to the endpoint
+func (l *RateLimiter) Weight(endpoint string) int {
+	if w, ok := l.Weights[endpoint]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// Wait blocks until n tokens are free. It gives up when ctx is done, or right
+// away when the wait would outlast the ctx deadline.
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	wait, take := l.reserve(n)
+	if wait <= 0 {
+		return nil
+	}
+
+	if dl, ok := ctx.Deadline(); ok && time.Until(dl) < wait {
+		l.cancel(take)
+		return fmt.Errorf("rate limit wait of %v would exceed deadline: %w", wait, context.DeadlineExceeded)
+	}
+
+	if err := sleep(ctx, wait); err != nil {
+		l.cancel(take)
+		return err
+	}
+	return nil
+}
+
+// reserve takes n tokens, possibly going into debt, and returns how long until
+// they are paid for
+func (l *RateLimiter) reserve(n int) (time.Duration, float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// a request heavier than the bucket could never be served
+	take := float64(n)
+	if take > l.burst {
+		take = l.burst
+	}
+	l.tokens -= take
+
+	if l.tokens >= 0 || l.rate <= 0 {
+		return 0, take
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second)), take
+}
+
+// cancel gives back tokens of an abandoned reservation
+func (l *RateLimiter) cancel(take float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens += take
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
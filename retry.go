@@ -0,0 +1,127 @@
+package idex
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy retries read-only requests that failed transiently: connection
+// errors, 5xx statuses and rate limiting. Only the return* endpoints are
+// retried, requests that change state are always sent once.
+type RetryPolicy struct {
+	// MaxAttempts including the first one, retries are disabled below 2
+	MaxAttempts int
+	// BaseDelay before the first retry, doubled for each following one
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff and any Retry-After asked by the server
+	MaxDelay time.Duration
+	// OnRetry, when set, is called before waiting for each retry
+	OnRetry func(RetryEvent)
+}
+
+// RetryEvent describes a retry about to happen
+type RetryEvent struct {
+	Endpoint string
+	// Attempt that failed, starting at 1
+	Attempt int
+	Delay   time.Duration
+	Err     error
+}
+
+// DefaultRetryPolicy makes up to 4 attempts, backing off from 250ms to 5s
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   250 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+// retryable endpoints only read data
+func retryable(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "return")
+}
+
+// shouldRetry is true when err is worth trying again
+func shouldRetry(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+
+	// anything else failed in transport: resets, refused connections, timeouts
+	return true
+}
+
+// delay before the retry following the failed attempt, with jitter
+func (p *RetryPolicy) delay(attempt int, err error) time.Duration {
+	d := backoff(p.BaseDelay, p.MaxDelay, attempt)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > d {
+		d = apiErr.RetryAfter
+		if p.MaxDelay > 0 && d > p.MaxDelay {
+			d = p.MaxDelay
+		}
+	}
+
+	return d
+}
+
+// backoff doubles base for each attempt after the first, up to max when it's
+// set, with jitter
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && (max <= 0 || d < max); i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	// jitter within the upper half so concurrent clients spread out
+	if d > 1 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	return d
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		if s < 0 {
+			return 0
+		}
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sleep for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
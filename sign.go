@@ -0,0 +1,149 @@
+package idex
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signature of a hash in the v, r, s form IDEX expects
+type Signature struct {
+	V int    `json:"v"`
+	R string `json:"r"`
+	S string `json:"s"`
+}
+
+// packAddress as the 20 bytes of an address
+func packAddress(address string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(address), "0x"))
+	if err != nil || len(b) != 20 {
+		return nil, fmt.Errorf("invalid address %q", address)
+	}
+	return b, nil
+}
+
+// packBytes32 as the 32 bytes of a hash
+func packBytes32(hash string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(hash), "0x"))
+	if err != nil || len(b) != 32 {
+		return nil, fmt.Errorf("invalid hash %q", hash)
+	}
+	return b, nil
+}
+
+// packUint256 as a 32 byte big endian integer
+func packUint256(i *big.Int) ([]byte, error) {
+	if i.Sign() < 0 || i.BitLen() > 256 {
+		return nil, fmt.Errorf("%v is not a uint256", i)
+	}
+	b := make([]byte, 32)
+	i.FillBytes(b)
+	return b, nil
+}
+
+// packDecimal as a uint256, d must be a whole number of base units
+func packDecimal(d Decimal) ([]byte, error) {
+	if !d.Equal(d.Truncate(0)) {
+		return nil, fmt.Errorf("%v is not a whole number of base units", d)
+	}
+	return packUint256(d.BigInt())
+}
+
+// soliditySHA3 is keccak256 of tightly packed values, as Solidity's
+// keccak256(abi.encodePacked(...)) and web3's soliditySha3 compute it
+func soliditySHA3(parts ...[]byte) []byte {
+	return crypto.Keccak256(parts...)
+}
+
+// personalHash prefixes a hash the way eth_sign does before signing it, which
+// is what the IDEX contract recovers signers against
+func personalHash(hash []byte) []byte {
+	return crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(hash))), hash)
+}
+
+// sign a hash with the signer, as eth_sign would
+func sign(signer Signer, hash []byte) (*Signature, error) {
+	if signer == nil {
+		return nil, ErrNoKey
+	}
+
+	sig, err := signer.SignHash(personalHash(hash))
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != 65 {
+		return nil, fmt.Errorf("signature should be 65 bytes, was %d", len(sig))
+	}
+
+	return &Signature{
+		V: int(sig[64]) + 27,
+		R: "0x" + hex.EncodeToString(sig[:32]),
+		S: "0x" + hex.EncodeToString(sig[32:64]),
+	}, nil
+}
+
+// orderHash of an order as computed by the IDEX contract
+func orderHash(contract string, p *Params) ([]byte, error) {
+	c, err := packAddress(contract)
+	if err != nil {
+		return nil, err
+	}
+	tb, err := packAddress(p.TokenBuy)
+	if err != nil {
+		return nil, err
+	}
+	ab, err := packDecimal(p.AmountBuy)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := packAddress(p.TokenSell)
+	if err != nil {
+		return nil, err
+	}
+	as, err := packDecimal(p.AmountSell)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := packUint256(big.NewInt(int64(p.Expires)))
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := packUint256(big.NewInt(int64(p.Nonce)))
+	if err != nil {
+		return nil, err
+	}
+	user, err := packAddress(p.User)
+	if err != nil {
+		return nil, err
+	}
+
+	return soliditySHA3(c, tb, ab, ts, as, exp, nonce, user), nil
+}
+
+// recoverSigner returns the address that signed hash with sig, as eth_sign
+func recoverSigner(hash []byte, sig *Signature) (string, error) {
+	r, err := packBytes32(sig.R)
+	if err != nil {
+		return "", err
+	}
+	s, err := packBytes32(sig.S)
+	if err != nil {
+		return "", err
+	}
+	v := sig.V
+	if v >= 27 {
+		v -= 27
+	}
+	if v != 0 && v != 1 {
+		return "", fmt.Errorf("invalid signature v %d", sig.V)
+	}
+
+	pub, err := crypto.SigToPub(personalHash(hash), append(append(r, s...), byte(v)))
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(crypto.PubkeyToAddress(*pub).Hex()), nil
+}
@@ -0,0 +1,69 @@
+package idex
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signer signs for an Ethereum account. It's all trading needs of a key, so
+// keys can live elsewhere, e.g. behind a remote signing service.
+type Signer interface {
+	// Address of the account, 0x prefixed
+	Address() string
+	// SignHash signs a 32 byte digest as is, returning the 65 byte [R || S || V]
+	// signature with V as 0 or 1, like go-ethereum's crypto.Sign
+	SignHash(hash []byte) ([]byte, error)
+}
+
+// KeySigner signs with a private key held in memory
+type KeySigner struct {
+	key     *ecdsa.PrivateKey
+	address string
+}
+
+// NewKeySigner for key
+func NewKeySigner(key *ecdsa.PrivateKey) *KeySigner {
+	return &KeySigner{key: key, address: strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())}
+}
+
+// NewKeySignerFromHex for a hex encoded private key
+func NewKeySignerFromHex(hexKey string) (*KeySigner, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySigner(key), nil
+}
+
+// NewKeystoreSigner decrypts an Ethereum V3 JSON keystore, scrypt or pbkdf2,
+// with its passphrase. The decrypted key is kept in memory.
+func NewKeystoreSigner(keyJSON []byte, passphrase string) (*KeySigner, error) {
+	k, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySigner(k.PrivateKey), nil
+}
+
+// LoadKeystoreSigner reads and decrypts the keystore file at path
+func LoadKeystoreSigner(path, passphrase string) (*KeySigner, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeystoreSigner(b, passphrase)
+}
+
+// Address of the key's account
+func (s *KeySigner) Address() string {
+	return s.address
+}
+
+// SignHash with the key
+func (s *KeySigner) SignHash(hash []byte) ([]byte, error) {
+	return crypto.Sign(hash, s.key)
+}
@@ -0,0 +1,99 @@
+package idex
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+)
+
+// Layouts of the dates sent by IDEX, always in UTC
+const (
+	DateTimeLayout = "2006-01-02 15:04:05"
+	ISOTimeLayout  = "2006-01-02T15:04:05.000Z"
+)
+
+// UnixTime is a timestamp sent as unix seconds, e.g. Trade.Timestamp
+type UnixTime struct {
+	time.Time
+}
+
+// DateTime is a date sent as "2018-08-31 22:10:53", e.g. Trade.Date
+type DateTime struct {
+	time.Time
+}
+
+// ISOTime is a date sent as "2018-08-31T22:10:53.000Z", e.g. UpdatedAt
+type ISOTime struct {
+	time.Time
+}
+
+// NewUnixTime returns the UTC time of unix seconds
+func NewUnixTime(sec int64) UnixTime {
+	return UnixTime{time.Unix(sec, 0).UTC()}
+}
+
+// MarshalJSON as unix seconds, 0 for the zero time
+func (t UnixTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("0"), nil
+	}
+	return []byte(strconv.FormatInt(t.Unix(), 10)), nil
+}
+
+// UnmarshalJSON from unix seconds, as a number or a string
+func (t *UnixTime) UnmarshalJSON(b []byte) error {
+	s := string(bytes.Trim(b, `"`))
+	if s == "null" || s == "" || s == "0" {
+		*t = UnixTime{}
+		return nil
+	}
+
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*t = NewUnixTime(sec)
+	return nil
+}
+
+// MarshalJSON in IDEX date layout, "" for the zero time
+func (t DateTime) MarshalJSON() ([]byte, error) {
+	return marshalLayout(t.Time, DateTimeLayout)
+}
+
+// UnmarshalJSON from IDEX date layout, read as UTC
+func (t *DateTime) UnmarshalJSON(b []byte) error {
+	return unmarshalLayout(b, DateTimeLayout, &t.Time)
+}
+
+// MarshalJSON in ISO-8601 with milliseconds, "" for the zero time
+func (t ISOTime) MarshalJSON() ([]byte, error) {
+	return marshalLayout(t.Time, ISOTimeLayout)
+}
+
+// UnmarshalJSON from ISO-8601, with or without fractional seconds
+func (t *ISOTime) UnmarshalJSON(b []byte) error {
+	return unmarshalLayout(b, time.RFC3339Nano, &t.Time)
+}
+
+func marshalLayout(t time.Time, layout string) ([]byte, error) {
+	if t.IsZero() {
+		return []byte(`""`), nil
+	}
+	return []byte(strconv.Quote(t.UTC().Format(layout))), nil
+}
+
+func unmarshalLayout(b []byte, layout string, t *time.Time) error {
+	s := string(bytes.Trim(b, `"`))
+	if s == "null" || s == "" {
+		*t = time.Time{}
+		return nil
+	}
+
+	v, err := time.ParseInLocation(layout, s, time.UTC)
+	if err != nil {
+		return err
+	}
+	*t = v.UTC()
+	return nil
+}
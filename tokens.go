@@ -0,0 +1,133 @@
+package idex
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minTokenRefresh between lazy refreshes, so a stream of unknown tokens
+// doesn't turn into a stream of Currencies requests
+const minTokenRefresh = time.Minute
+
+// Token is a currency supported by IDEX
+type Token struct {
+	Symbol   string
+	Name     string
+	Address  string
+	Decimals int
+}
+
+// ToBase converts a human amount, e.g. 1.5 ETH, to integer base units, e.g.
+// 1500000000000000000 wei. Digits past the token's decimals are truncated.
+func (t *Token) ToBase(amount Decimal) Decimal {
+	return amount.Shift(int32(t.Decimals)).Truncate(0)
+}
+
+// FromBase converts integer base units to a human amount
+func (t *Token) FromBase(amount Decimal) Decimal {
+	return amount.Shift(-int32(t.Decimals))
+}
+
+// TokenRegistry finds tokens by symbol or address, loading them from
+// Currencies on first use and again when an unknown token is looked up
+type TokenRegistry struct {
+	api *API
+
+	mu          sync.RWMutex
+	bySymbol    map[string]*Token
+	byAddress   map[string]*Token
+	lastRefresh time.Time
+}
+
+// NewTokenRegistry backed by the API's Currencies
+func NewTokenRegistry(a *API) *TokenRegistry {
+	return &TokenRegistry{api: a}
+}
+
+// Refresh reloads all tokens from Currencies
+func (r *TokenRegistry) Refresh(ctx context.Context) error {
+	cs, err := r.api.CurrenciesContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	bySymbol := make(map[string]*Token, len(cs))
+	byAddress := make(map[string]*Token, len(cs))
+	for sym, c := range cs {
+		t := &Token{Symbol: sym, Name: c.Name, Address: strings.ToLower(c.Address), Decimals: c.Decimals}
+		bySymbol[sym] = t
+		byAddress[t.Address] = t
+	}
+
+	r.mu.Lock()
+	r.bySymbol, r.byAddress = bySymbol, byAddress
+	r.lastRefresh = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Token by symbol, e.g. "AUC", or by address in any case
+func (r *TokenRegistry) Token(ctx context.Context, symbolOrAddress string) (*Token, error) {
+	if t := r.lookup(symbolOrAddress); t != nil {
+		return t, nil
+	}
+
+	r.mu.RLock()
+	stale := time.Since(r.lastRefresh) >= minTokenRefresh
+	r.mu.RUnlock()
+
+	if stale {
+		if err := r.Refresh(ctx); err != nil {
+			return nil, err
+		}
+		if t := r.lookup(symbolOrAddress); t != nil {
+			return t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %v", ErrUnknownToken, symbolOrAddress)
+}
+
+func (r *TokenRegistry) lookup(key string) *Token {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if strings.HasPrefix(key, "0x") || strings.HasPrefix(key, "0X") {
+		return r.byAddress[strings.ToLower(key)]
+	}
+	return r.bySymbol[key]
+}
+
+// Tokens currently known, without refreshing
+func (r *TokenRegistry) Tokens() []*Token {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ts := make([]*Token, 0, len(r.bySymbol))
+	for _, t := range r.bySymbol {
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+// ToBase converts a human amount of the token to integer base units
+func (r *TokenRegistry) ToBase(ctx context.Context, symbolOrAddress string, amount Decimal) (Decimal, error) {
+	t, err := r.Token(ctx, symbolOrAddress)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return t.ToBase(amount), nil
+}
+
+// FromBase converts integer base units of the token to a human amount
+func (r *TokenRegistry) FromBase(ctx context.Context, symbolOrAddress string, amount Decimal) (Decimal, error) {
+	t, err := r.Token(ctx, symbolOrAddress)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return t.FromBase(amount), nil
+}
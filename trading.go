@@ -0,0 +1,648 @@
+package idex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// account address of the API's signer
+func (a *API) account() (string, error) {
+	if a.Signer == nil {
+		return "", ErrNoKey
+	}
+	return strings.ToLower(a.Signer.Address()), nil
+}
+
+// nonce reserves n consecutive nonces for user, from the API's NonceManager
+// when it has one or straight from NextNonce otherwise
+func (a *API) nonce(ctx context.Context, user string, n int) (int, error) {
+	if a.Nonces != nil {
+		return a.Nonces.Reserve(ctx, user, n)
+	}
+	return a.NextNonceContext(ctx, user)
+}
+
+// postSigned posts a signed request, resyncing the user's nonces when IDEX
+// rejects the one used
+func (a *API) postSigned(ctx context.Context, endpoint, user, payload string) ([]byte, error) {
+	body, err := a.PostContext(ctx, endpoint, payload)
+	if err != nil && a.Nonces != nil && errors.Is(err, ErrInvalidNonce) {
+		if rerr := a.Nonces.Resync(ctx, user); rerr != nil {
+			return nil, fmt.Errorf("%w, and resyncing nonces failed: %v", err, rerr)
+		}
+	}
+	return body, err
+}
+
+// registry of tokens, created on first use
+func (a *API) registry() *TokenRegistry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.tokens == nil {
+		a.tokens = NewTokenRegistry(a)
+	}
+	return a.tokens
+}
+
+// contractAddress, fetched once and cached
+func (a *API) contractAddress(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	c := a.contract
+	a.mu.Unlock()
+	if c != "" {
+		return c, nil
+	}
+
+	c, err := a.ContractAddressContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	a.contract = c
+	a.mu.Unlock()
+
+	return c, nil
+}
+
+type orderPayload struct {
+	TokenBuy   string  `json:"tokenBuy"`
+	AmountBuy  Decimal `json:"amountBuy"`
+	TokenSell  string  `json:"tokenSell"`
+	AmountSell Decimal `json:"amountSell"`
+	Address    string  `json:"address"`
+	Nonce      int     `json:"nonce"`
+	Expires    int     `json:"expires"`
+	*Signature
+}
+
+// Order places a signed limit order to buy or sell amount of the market's
+// quote token at price, in human units. IDEX doesn't enforce expires yet.
+func (a *API) Order(market string, side Side, price, amount Decimal, expires int) (*OpenOrder, error) {
+	return a.OrderContext(context.Background(), market, side, price, amount, expires)
+}
+
+// OrderContext is like Order but uses ctx for the requests
+func (a *API) OrderContext(ctx context.Context, market string, side Side, price, amount Decimal, expires int) (*OpenOrder, error) {
+	m, err := ParseMarket(market)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.account()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := a.OrderParamsContext(ctx, m.String(), side, price, amount)
+	if err != nil {
+		return nil, err
+	}
+	p.Expires, p.User = expires, user
+
+	return a.placeOrder(ctx, m, p)
+}
+
+// OrderParams converts a limit order to buy or sell quantity of the market's
+// quote token at price into the base unit amounts IDEX orders are made of.
+// It leaves Expires, Nonce and User for the caller.
+func (a *API) OrderParams(market string, side Side, price, quantity Decimal) (*Params, error) {
+	return a.OrderParamsContext(context.Background(), market, side, price, quantity)
+}
+
+// OrderParamsContext is like OrderParams but uses ctx for the requests
+func (a *API) OrderParamsContext(ctx context.Context, market string, side Side, price, quantity Decimal) (*Params, error) {
+	m, err := ParseMarket(market)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := a.registry().Token(ctx, m.Base())
+	if err != nil {
+		return nil, err
+	}
+	quote, err := a.registry().Token(ctx, m.Quote())
+	if err != nil {
+		return nil, err
+	}
+
+	return NewOrderParams(base, quote, side, price, quantity)
+}
+
+// NewOrderParams converts a limit order on the base/quote market into its
+// Params. quantity is truncated to what the quote token can represent, and the
+// base token total is rounded so the order's effective price never goes past
+// price: down for a buy, which spends it, and up for a sell, which receives it.
+func NewOrderParams(base, quote *Token, side Side, price, quantity Decimal) (*Params, error) {
+	if side != Buy && side != Sell {
+		return nil, fmt.Errorf("invalid side %q", side)
+	}
+	if price.Sign() <= 0 || quantity.Sign() <= 0 {
+		return nil, fmt.Errorf("price and quantity must be positive")
+	}
+
+	quoteAmount := quote.ToBase(quantity)
+	total := price.Mul(quote.FromBase(quoteAmount)).Shift(int32(base.Decimals))
+
+	var baseAmount Decimal
+	if side == Buy {
+		baseAmount = total.Floor(0)
+	} else {
+		baseAmount = total.Ceil(0)
+	}
+	if quoteAmount.IsZero() || baseAmount.IsZero() {
+		return nil, fmt.Errorf("order too small for %v_%v", base.Symbol, quote.Symbol)
+	}
+
+	p := &Params{}
+	if side == Buy {
+		p.TokenBuy, p.BuySymbol, p.BuyPrecision, p.AmountBuy = quote.Address, quote.Symbol, quote.Decimals, quoteAmount
+		p.TokenSell, p.SellSymbol, p.SellPrecision, p.AmountSell = base.Address, base.Symbol, base.Decimals, baseAmount
+	} else {
+		p.TokenBuy, p.BuySymbol, p.BuyPrecision, p.AmountBuy = base.Address, base.Symbol, base.Decimals, baseAmount
+		p.TokenSell, p.SellSymbol, p.SellPrecision, p.AmountSell = quote.Address, quote.Symbol, quote.Decimals, quoteAmount
+	}
+
+	return p, nil
+}
+
+// PriceQuantity is the reverse of NewOrderParams: the side, price and quantity
+// of p on the base/quote market. The price is only promised to build the same
+// Params again. It isn't the limit p was built from and can be a little past
+// it, above for a buy and below for a sell, so don't treat it as that limit.
+func (p *Params) PriceQuantity(base, quote *Token) (Side, Decimal, Decimal, error) {
+	var side Side
+	var baseAmount, quoteAmount Decimal
+	switch {
+	case strings.EqualFold(p.TokenBuy, quote.Address) && strings.EqualFold(p.TokenSell, base.Address):
+		side, baseAmount, quoteAmount = Buy, p.AmountSell, p.AmountBuy
+	case strings.EqualFold(p.TokenBuy, base.Address) && strings.EqualFold(p.TokenSell, quote.Address):
+		side, baseAmount, quoteAmount = Sell, p.AmountBuy, p.AmountSell
+	default:
+		return "", Decimal{}, Decimal{}, fmt.Errorf("order is not on the %v_%v market", base.Symbol, quote.Symbol)
+	}
+	if quoteAmount.Sign() <= 0 {
+		return "", Decimal{}, Decimal{}, fmt.Errorf("order has no %v amount", quote.Symbol)
+	}
+
+	// rounded the way NewOrderParams rounds back to the same base amount
+	mode := RoundFloor
+	if side == Buy {
+		mode = RoundCeiling
+	}
+	// the price's rounding error times the quote amount must stay under a base
+	// unit, so it needs as many more places as the quote amount has digits
+	places := int32(base.Decimals + quote.Decimals + len(quoteAmount.BigInt().String()))
+	quantity := quote.FromBase(quoteAmount)
+	price := base.FromBase(baseAmount).Div(quantity, places, mode)
+
+	return side, price, quantity, nil
+}
+
+// placeOrder signs and submits the order described by p, filling in its nonce
+func (a *API) placeOrder(ctx context.Context, m Market, p *Params) (*OpenOrder, error) {
+	contract, err := a.contractAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.Nonce, err = a.nonce(ctx, p.User, 1); err != nil {
+		return nil, err
+	}
+
+	hash, err := orderHash(contract, p)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sign(a.Signer, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := encode(&orderPayload{
+		TokenBuy:   p.TokenBuy,
+		AmountBuy:  p.AmountBuy,
+		TokenSell:  p.TokenSell,
+		AmountSell: p.AmountSell,
+		Address:    p.User,
+		Nonce:      p.Nonce,
+		Expires:    p.Expires,
+		Signature:  sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := a.postSigned(ctx, "order", p.User, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &OpenOrder{}
+	if err := json.Unmarshal(body, o); err != nil {
+		return nil, err
+	}
+	if o.Market == "" {
+		o.Market = m.String()
+	}
+	if o.Params == nil {
+		o.Params = p
+	}
+
+	return o, nil
+}
+
+// resolver of markets sharing the API's tokens, created on first use
+func (a *API) resolver() *MarketResolver {
+	tokens := a.registry()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.markets == nil {
+		a.markets = &MarketResolver{Tokens: tokens, api: a}
+	}
+	return a.markets
+}
+
+// Fill takes Amount of the quote token, in human units, from a resting order
+// of the OrderBook. Amount can't be more than the order's remaining Amount.
+type Fill struct {
+	Order  *Order
+	Amount Decimal
+}
+
+// Sweep returns the fills that buy or sell up to quantity of the quote token
+// against the book's orders, best price first, without going past limit
+func Sweep(book *OrderBook, side Side, limit, quantity Decimal) []Fill {
+	orders := book.Asks
+	better := func(price Decimal) bool { return price.Cmp(limit) <= 0 }
+	if side == Sell {
+		orders = book.Bids
+		better = func(price Decimal) bool { return price.Cmp(limit) >= 0 }
+	}
+
+	var fills []Fill
+	left := quantity
+	for i := range orders {
+		o := &orders[i]
+		if left.Sign() <= 0 || !better(o.Price) {
+			break
+		}
+		amount := o.Amount
+		if amount.Cmp(left) > 0 {
+			amount = left
+		}
+		fills = append(fills, Fill{Order: o, Amount: amount})
+		left = left.Sub(amount)
+	}
+
+	return fills
+}
+
+type tradePayload struct {
+	OrderHash string  `json:"orderHash"`
+	Amount    Decimal `json:"amount"`
+	Nonce     int     `json:"nonce"`
+	Address   string  `json:"address"`
+	*Signature
+}
+
+// Trade signs and submits fills against resting orders in one batch,
+// returning the resulting trades
+func (a *API) Trade(fills []Fill) ([]*Trade, error) {
+	return a.TradeContext(context.Background(), fills)
+}
+
+// TradeContext is like Trade but uses ctx for the requests
+func (a *API) TradeContext(ctx context.Context, fills []Fill) ([]*Trade, error) {
+	if len(fills) == 0 {
+		return nil, fmt.Errorf("fills are required")
+	}
+
+	user, err := a.account()
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := make([]Decimal, len(fills))
+	// fills of the same order share what's left on it
+	filled := map[string]Decimal{}
+	for i, f := range fills {
+		if amounts[i], err = a.fillAmount(ctx, f); err != nil {
+			return nil, err
+		}
+
+		hash := strings.ToLower(f.Order.OrderHash)
+		filled[hash] = filled[hash].Add(f.Amount)
+		if filled[hash].Cmp(f.Order.Amount) > 0 {
+			return nil, fmt.Errorf("fills of %v are more than the %v left on order %v", filled[hash], f.Order.Amount, f.Order.OrderHash)
+		}
+	}
+
+	nonce, err := a.nonce(ctx, user, len(fills))
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make([]*tradePayload, len(fills))
+	for i, f := range fills {
+		h, err := packBytes32(f.Order.OrderHash)
+		if err != nil {
+			return nil, err
+		}
+		amount, err := packDecimal(amounts[i])
+		if err != nil {
+			return nil, err
+		}
+		addr, err := packAddress(user)
+		if err != nil {
+			return nil, err
+		}
+		n, err := packUint256(big.NewInt(int64(nonce + i)))
+		if err != nil {
+			return nil, err
+		}
+
+		sig, err := sign(a.Signer, soliditySHA3(h, amount, addr, n))
+		if err != nil {
+			return nil, err
+		}
+		payloads[i] = &tradePayload{
+			OrderHash: f.Order.OrderHash,
+			Amount:    amounts[i],
+			Nonce:     nonce + i,
+			Address:   user,
+			Signature: sig,
+		}
+	}
+
+	payload, err := encode(payloads)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := a.postSigned(ctx, "trade", user, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var ts []*Trade
+	if err := json.Unmarshal(body, &ts); err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+// fillAmount converts a fill to base units of the order's buy token, the
+// amount IDEX expects in a trade
+func (a *API) fillAmount(ctx context.Context, f Fill) (Decimal, error) {
+	o := f.Order
+	if o == nil || o.Params == nil || o.OrderHash == "" {
+		return Decimal{}, fmt.Errorf("fill needs an order with its hash and params")
+	}
+	if f.Amount.Sign() <= 0 {
+		return Decimal{}, fmt.Errorf("fill amount must be positive")
+	}
+	if f.Amount.Cmp(o.Amount) > 0 {
+		return Decimal{}, fmt.Errorf("fill of %v is more than the %v left on order %v", f.Amount, o.Amount, o.OrderHash)
+	}
+
+	m, side, err := a.resolver().Resolve(ctx, o.Params.TokenBuy, o.Params.TokenSell)
+	if err != nil {
+		return Decimal{}, err
+	}
+	quote, err := a.registry().Token(ctx, m.Quote())
+	if err != nil {
+		return Decimal{}, err
+	}
+
+	amount := quote.ToBase(f.Amount)
+	if side == Sell {
+		// the maker sells the quote token, so the fill is paid in its base token
+		// at the order's own exchange rate
+		if o.Params.AmountSell.IsZero() {
+			return Decimal{}, fmt.Errorf("order %v has no amount to sell", o.OrderHash)
+		}
+		amount = amount.Mul(o.Params.AmountBuy).Div(o.Params.AmountSell, 0, RoundDown)
+	}
+	if amount.IsZero() {
+		return Decimal{}, fmt.Errorf("fill of %v is too small for order %v", f.Amount, o.OrderHash)
+	}
+
+	return amount, nil
+}
+
+// CancelStatus tells how a cancel ended
+type CancelStatus int
+
+// Cancel outcomes
+const (
+	// Cancelled order is off the book
+	Cancelled CancelStatus = iota
+	// CancelAlreadyFilled order had traded before the cancel came in
+	CancelAlreadyFilled
+	// CancelUnknownOrder hash doesn't match an order of the account
+	CancelUnknownOrder
+)
+
+func (s CancelStatus) String() string {
+	switch s {
+	case Cancelled:
+		return "cancelled"
+	case CancelAlreadyFilled:
+		return "already filled"
+	case CancelUnknownOrder:
+		return "unknown order"
+	}
+	return fmt.Sprintf("CancelStatus(%d)", int(s))
+}
+
+// CancelResult of a cancel request
+type CancelResult struct {
+	OrderHash string
+	Status    CancelStatus
+	// Message from the server when the order wasn't cancelled
+	Message string
+}
+
+type cancelPayload struct {
+	OrderHash string `json:"orderHash"`
+	Nonce     int    `json:"nonce"`
+	Address   string `json:"address"`
+	*Signature
+}
+
+// Cancel signs and submits the cancellation of one of the account's orders.
+// Orders that were filled or don't exist are reported in the result's Status
+// rather than as errors.
+func (a *API) Cancel(orderHash string) (*CancelResult, error) {
+	return a.CancelContext(context.Background(), orderHash)
+}
+
+// CancelContext is like Cancel but uses ctx for the requests
+func (a *API) CancelContext(ctx context.Context, orderHash string) (*CancelResult, error) {
+	h, err := packBytes32(orderHash)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.account()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := a.nonce(ctx, user, 1)
+	if err != nil {
+		return nil, err
+	}
+	n, err := packUint256(big.NewInt(int64(nonce)))
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := sign(a.Signer, soliditySHA3(h, n))
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := encode(&cancelPayload{
+		OrderHash: orderHash,
+		Nonce:     nonce,
+		Address:   user,
+		Signature: sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &CancelResult{OrderHash: orderHash}
+
+	body, err := a.postSigned(ctx, "cancel", user, payload)
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, ErrOrderFilled) && errors.As(err, &apiErr):
+		res.Status, res.Message = CancelAlreadyFilled, apiErr.Message
+		return res, nil
+	case errors.Is(err, ErrOrderNotFound) && errors.As(err, &apiErr):
+		res.Status, res.Message = CancelUnknownOrder, apiErr.Message
+		return res, nil
+	case err != nil:
+		return nil, err
+	}
+
+	r := &struct {
+		Success json.RawMessage `json:"success"`
+	}{}
+	if err := json.Unmarshal(body, r); err != nil {
+		return nil, err
+	}
+	if s := string(r.Success); s != "1" && s != "true" {
+		return nil, fmt.Errorf("cancel of %v not confirmed: %s", orderHash, body)
+	}
+
+	res.Status = Cancelled
+	return res, nil
+}
+
+type withdrawPayload struct {
+	Address string  `json:"address"`
+	Amount  Decimal `json:"amount"`
+	Token   string  `json:"token"`
+	Nonce   int     `json:"nonce"`
+	*Signature
+}
+
+// Withdraw signs and submits a withdrawal of amount, in human units, of the
+// token given by symbol or address from the contract to the account. It
+// refuses to withdraw more than the available balance, or an amount with more
+// decimals than the token has.
+func (a *API) Withdraw(token string, amount Decimal) error {
+	return a.WithdrawContext(context.Background(), token, amount)
+}
+
+// WithdrawContext is like Withdraw but uses ctx for the requests
+func (a *API) WithdrawContext(ctx context.Context, token string, amount Decimal) error {
+	if amount.Sign() <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+
+	user, err := a.account()
+	if err != nil {
+		return err
+	}
+	t, err := a.registry().Token(ctx, token)
+	if err != nil {
+		return err
+	}
+	// never withdraw less than asked by dropping digits the token can't hold
+	base := t.ToBase(amount)
+	if !base.Equal(amount.Shift(int32(t.Decimals))) {
+		return fmt.Errorf("amount %v has more than the %d decimals of %v", amount, t.Decimals, t.Symbol)
+	}
+
+	bs, err := a.CompleteBalancesContext(ctx, user)
+	if err != nil {
+		return err
+	}
+	var available Decimal
+	if b := bs[t.Symbol]; b != nil {
+		available = b.Available
+	}
+	if amount.Cmp(available) > 0 {
+		return fmt.Errorf("%w: %v %v requested, %v available", ErrInsufficientBalance, amount, t.Symbol, available)
+	}
+
+	contract, err := a.contractAddress(ctx)
+	if err != nil {
+		return err
+	}
+	nonce, err := a.nonce(ctx, user, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := packAddress(contract)
+	if err != nil {
+		return err
+	}
+	tok, err := packAddress(t.Address)
+	if err != nil {
+		return err
+	}
+	amt, err := packDecimal(base)
+	if err != nil {
+		return err
+	}
+	addr, err := packAddress(user)
+	if err != nil {
+		return err
+	}
+	n, err := packUint256(big.NewInt(int64(nonce)))
+	if err != nil {
+		return err
+	}
+
+	sig, err := sign(a.Signer, soliditySHA3(c, tok, amt, addr, n))
+	if err != nil {
+		return err
+	}
+
+	payload, err := encode(&withdrawPayload{
+		Address:   user,
+		Amount:    base,
+		Token:     t.Address,
+		Nonce:     nonce,
+		Signature: sig,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = a.postSigned(ctx, "withdraw", user, payload)
+	return err
+}
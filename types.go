@@ -1,15 +1,21 @@
 package idex
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // Ticker data
 type Ticker struct {
-	Last          string `json:"last"`
-	High          string `json:"high"`
-	Low           string `json:"low"`
-	LowestAsk     string `json:"lowestAsk"`
-	HighestBid    string `json:"highestBid"`
-	PercentChange string `json:"percentChange"`
-	BaseVolume    string `json:"baseVolume"`
-	QuoteVolume   string `json:"quoteVolume"`
+	Last          Decimal `json:"last"`
+	High          Decimal `json:"high"`
+	Low           Decimal `json:"low"`
+	LowestAsk     Decimal `json:"lowestAsk"`
+	HighestBid    Decimal `json:"highestBid"`
+	PercentChange Decimal `json:"percentChange"`
+	BaseVolume    Decimal `json:"baseVolume"`
+	QuoteVolume   Decimal `json:"quoteVolume"`
 }
 
 // OrderBook holds bid and ask orders for a market
@@ -20,58 +26,58 @@ type OrderBook struct {
 
 // Order held in OrderBook
 type Order struct {
-	Price     string  `json:"price"`
-	Amount    string  `json:"amount"`
-	Total     string  `json:"total"`
+	Price     Decimal `json:"price"`
+	Amount    Decimal `json:"amount"`
+	Total     Decimal `json:"total"`
 	OrderHash string  `json:"orderHash"`
 	Params    *Params `json:"params"`
 }
 
 // OpenOrder for a market or user
 type OpenOrder struct {
-	Timestamp   int     `json:"timestamp"`
-	Price       string  `json:"price"`
-	Amount      string  `json:"amount"`
-	Total       string  `json:"total"`
-	OrderHash   string  `json:"orderHash"`
-	Market      string  `json:"market"`
-	Type        string  `json:"type"`
-	OrderNumber int     `json:"orderNumber"`
-	Params      *Params `json:"params"`
+	Timestamp   UnixTime `json:"timestamp"`
+	Price       Decimal  `json:"price"`
+	Amount      Decimal  `json:"amount"`
+	Total       Decimal  `json:"total"`
+	OrderHash   string   `json:"orderHash"`
+	Market      string   `json:"market"`
+	Type        string   `json:"type"`
+	OrderNumber int      `json:"orderNumber"`
+	Params      *Params  `json:"params"`
 }
 
 // Params of an Order
 type Params struct {
-	TokenBuy      string `json:"tokenBuy"`
-	BuySymbol     string `json:"buySymbol"`
-	BuyPrecision  int    `json:"buyPrecision"`
-	AmountBuy     string `json:"amountBuy"`
-	TokenSell     string `json:"tokenSell"`
-	SellSymbol    string `json:"sellSymbol"`
-	SellPrecision int    `json:"sellPrecision"`
-	AmountSell    string `json:"amountSell"`
-	Expires       int    `json:"expires"`
-	Nonce         int    `json:"nonce"`
-	User          string `json:"user"`
+	TokenBuy      string  `json:"tokenBuy"`
+	BuySymbol     string  `json:"buySymbol"`
+	BuyPrecision  int     `json:"buyPrecision"`
+	AmountBuy     Decimal `json:"amountBuy"`
+	TokenSell     string  `json:"tokenSell"`
+	SellSymbol    string  `json:"sellSymbol"`
+	SellPrecision int     `json:"sellPrecision"`
+	AmountSell    Decimal `json:"amountSell"`
+	Expires       int     `json:"expires"`
+	Nonce         int     `json:"nonce"`
+	User          string  `json:"user"`
 }
 
 // Trade holds details about a trade
 type Trade struct {
-	Date            string `json:"date"`
-	Amount          string `json:"amount"`
-	Type            string `json:"type"`
-	Total           string `json:"total"`
-	Price           string `json:"price"`
-	OrderHash       string `json:"orderHash"`
-	UUID            string `json:"uuid"`
-	BuyerFee        string `json:"buyerFee"`
-	SellerFee       string `json:"sellerFee"`
-	GasFee          string `json:"gasFee"`
-	Timestamp       int    `json:"timestamp"`
-	Maker           string `json:"maker"`
-	Taker           string `json:"taker"`
-	TransactionHash string `json:"transactionHash"`
-	USDValue        string `json:"usdValue"`
+	Date            DateTime `json:"date"`
+	Amount          Decimal  `json:"amount"`
+	Type            string   `json:"type"`
+	Total           Decimal  `json:"total"`
+	Price           Decimal  `json:"price"`
+	OrderHash       string   `json:"orderHash"`
+	UUID            string   `json:"uuid"`
+	BuyerFee        Decimal  `json:"buyerFee"`
+	SellerFee       Decimal  `json:"sellerFee"`
+	GasFee          Decimal  `json:"gasFee"`
+	Timestamp       UnixTime `json:"timestamp"`
+	Maker           string   `json:"maker"`
+	Taker           string   `json:"taker"`
+	TransactionHash string   `json:"transactionHash"`
+	USDValue        Decimal  `json:"usdValue"`
 }
 
 // Currency holds details about supported currencies
@@ -83,100 +89,135 @@ type Currency struct {
 
 // Balance of token available and in open orders
 type Balance struct {
-	Available string `json:"available"`
-	OnOrders  string `json:"onOrders"`
+	Available Decimal `json:"available"`
+	OnOrders  Decimal `json:"onOrders"`
 }
 
 // Deposit holds information about a user's deposits
 type Deposit struct {
-	DepositNumber   int    `json:"depositNumber"`
-	Currency        string `json:"currency"`
-	Amount          string `json:"amount"`
-	Timestamp       int    `json:"timestamp"`
-	TransactionHash string `json:"transactionHash"`
+	DepositNumber   int      `json:"depositNumber"`
+	Currency        string   `json:"currency"`
+	Amount          Decimal  `json:"amount"`
+	Timestamp       UnixTime `json:"timestamp"`
+	TransactionHash string   `json:"transactionHash"`
 }
 
 // Withdrawal holds information about a user's withdrawals
 type Withdrawal struct {
-	WithdrawalNumber int    `json:"depositNumber"`
-	Currency         string `json:"currency"`
-	Amount           string `json:"amount"`
-	Timestamp        int    `json:"timestamp"`
-	TransactionHash  string `json:"transactionHash"`
-	Status           string `json:"status"`
+	WithdrawalNumber int      `json:"depositNumber"`
+	Currency         string   `json:"currency"`
+	Amount           Decimal  `json:"amount"`
+	Timestamp        UnixTime `json:"timestamp"`
+	TransactionHash  string   `json:"transactionHash"`
+	Status           string   `json:"status"`
 }
 
 // Volume maps markets to ETH and TOKEN amounts, with total eth volume
 type Volume struct {
-	Markets  map[string]map[string]string
-	TotalETH string
+	Markets  map[string]map[string]Decimal
+	TotalETH Decimal
 }
 
 // TradeInserted event
 type TradeInserted struct {
-	ID              int    `json:"id"`
-	Price           string `json:"price"`
-	AmountPrecision string `json:"amountPrecision"`
-	TotalPrecision  string `json:"totalPrecision"`
-	Date            string `json:"date"`
-	Timestamp       int    `json:"timestamp"`
-	SellerFee       string `json:"sellerFee"`
-	BuyerFee        string `json:"buyerFee"`
-	Type            string `json:"type"`
-	TokenBuy        string `json:"tokenBuy"`
-	AmountBuy       string `json:"amountBuy"`
-	TokenSell       string `json:"tokenSell"`
-	AmountSell      string `json:"amountSell"`
-	FeeMake         string `json:"feeMake"`
-	FeeTake         string `json:"feeTake"`
-	GasFee          string `json:"gasFee"`
-	Buy             string `json:"buy"`
-	V               int    `json:"v"`
-	R               string `json:"r"`
-	S               string `json:"s"`
-	User            string `json:"user"`
-	Sell            string `json:"sell"`
-	Hash            string `json:"hash"`
-	Nonce           int    `json:"nonce"`
-	Amount          string `json:"amount"`
-	USDValue        string `json:"usdValue"`
-	GasFeeAdjusted  string `json:"gasFeeAdjusted"`
-	UUID            string `json:"uuid"`
-	UpdatedAt       string `json:"updatedAt"`
-	CreatedAt       string `json:"createdAt"`
+	ID              int      `json:"id"`
+	Price           Decimal  `json:"price"`
+	AmountPrecision Decimal  `json:"amountPrecision"`
+	TotalPrecision  Decimal  `json:"totalPrecision"`
+	Date            DateTime `json:"date"`
+	Timestamp       UnixTime `json:"timestamp"`
+	SellerFee       Decimal  `json:"sellerFee"`
+	BuyerFee        Decimal  `json:"buyerFee"`
+	Type            string   `json:"type"`
+	TokenBuy        string   `json:"tokenBuy"`
+	AmountBuy       Decimal  `json:"amountBuy"`
+	TokenSell       string   `json:"tokenSell"`
+	AmountSell      Decimal  `json:"amountSell"`
+	FeeMake         Decimal  `json:"feeMake"`
+	FeeTake         Decimal  `json:"feeTake"`
+	GasFee          Decimal  `json:"gasFee"`
+	Buy             string   `json:"buy"`
+	V               int      `json:"v"`
+	R               string   `json:"r"`
+	S               string   `json:"s"`
+	User            string   `json:"user"`
+	Sell            string   `json:"sell"`
+	Hash            string   `json:"hash"`
+	Nonce           int      `json:"nonce"`
+	Amount          Decimal  `json:"amount"`
+	USDValue        Decimal  `json:"usdValue"`
+	GasFeeAdjusted  Decimal  `json:"gasFeeAdjusted"`
+	UUID            string   `json:"uuid"`
+	UpdatedAt       ISOTime  `json:"updatedAt"`
+	CreatedAt       ISOTime  `json:"createdAt"`
 }
 
 // OrderInserted event
 type OrderInserted struct {
-	Complete        bool   `json:"complete"`
-	ID              int    `json:"id"`
-	TokenBuy        string `json:"tokenBuy"`
-	AmountBuy       string `json:"amountBuy"`
-	TokenSell       string `json:"tokenSell"`
-	AmountSell      string `json:"amountSell"`
-	Expires         int    `json:"expires"`
-	Nonce           int    `json:"nonce"`
-	User            string `json:"user"`
-	V               int    `json:"v"`
-	R               string `json:"r"`
-	S               string `json:"s"`
-	Hash            string `json:"hash"`
-	FeeDiscount     string `json:"feeDiscount"`
-	RewardsMultiple string `json:"rewardsMultiple"`
-	UpdatedAt       string `json:"updatedAt"`
-	CreatedAt       string `json:"createdAt"`
+	Complete        bool    `json:"complete"`
+	ID              int     `json:"id"`
+	TokenBuy        string  `json:"tokenBuy"`
+	AmountBuy       Decimal `json:"amountBuy"`
+	TokenSell       string  `json:"tokenSell"`
+	AmountSell      Decimal `json:"amountSell"`
+	Expires         int     `json:"expires"`
+	Nonce           int     `json:"nonce"`
+	User            string  `json:"user"`
+	V               int     `json:"v"`
+	R               string  `json:"r"`
+	S               string  `json:"s"`
+	Hash            string  `json:"hash"`
+	FeeDiscount     Decimal `json:"feeDiscount"`
+	RewardsMultiple Decimal `json:"rewardsMultiple"`
+	UpdatedAt       ISOTime `json:"updatedAt"`
+	CreatedAt       ISOTime `json:"createdAt"`
 }
 
 // PushCancel event
 type PushCancel struct {
-	ID        int    `json:"id"`
-	Hash      string `json:"hash"`
-	User      string `json:"user"`
-	V         int    `json:"v"`
-	R         string `json:"r"`
-	S         string `json:"s"`
-	UpdatedAt string `json:"updatedAt"`
-	CreatedAt string `json:"createdAt"`
+	ID        int     `json:"id"`
+	Hash      string  `json:"hash"`
+	User      string  `json:"user"`
+	V         int     `json:"v"`
+	R         string  `json:"r"`
+	S         string  `json:"s"`
+	UpdatedAt ISOTime `json:"updatedAt"`
+	CreatedAt ISOTime `json:"createdAt"`
+}
+
+// EthPrice event, the price of one ether in USD
+type EthPrice struct {
+	USD Decimal
+}
+
+// UnmarshalJSON from the bare price IDEX pushes as payload
+func (e *EthPrice) UnmarshalJSON(b []byte) error {
+	return e.USD.UnmarshalJSON(b)
+}
+
+// ServerBlock event, the latest block the server has processed
+type ServerBlock struct {
+	Number int64
+}
+
+// UnmarshalJSON from the bare block number IDEX pushes as payload, quoted or not
+func (s *ServerBlock) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(b), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid block number %s", b)
+	}
+	s.Number = n
+	return nil
+}
+
+// RewardPoolSize event, the size of the trading reward pool in IDEX tokens
+type RewardPoolSize struct {
+	Size Decimal
+}
+
+// UnmarshalJSON from the bare size IDEX pushes as payload
+func (r *RewardPoolSize) UnmarshalJSON(b []byte) error {
+	return r.Size.UnmarshalJSON(b)
 }
 
 // Method name of websocket event
@@ -190,4 +231,15 @@ type SocketResponse struct {
 	TradeInserted *TradeInserted
 	PushCancel    *PushCancel
 	Error         error
+	// VerifyError is set when the event failed verification, see Socket.Verify
+	VerifyError error
+	// Connection is set when the connection dropped or came back
+	Connection *ConnectionEvent
+	// Handshake is set when the server replied to the handshake
+	Handshake *HandshakeResult
+	// EthPrice, ServerBlock and RewardPoolSize are set for the server's
+	// periodic pushes, the latest of each is also kept by the Socket
+	EthPrice       *EthPrice
+	ServerBlock    *ServerBlock
+	RewardPoolSize *RewardPoolSize
 }
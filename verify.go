@@ -0,0 +1,115 @@
+package idex
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultContractAddress of the IDEX exchange contract that orders are signed for
+const DefaultContractAddress = "0x2a0c0dbecc7e4d658f48e01e3fa353f44050c208"
+
+// VerifyMode decides what Monitor does with order and trade events that fail
+// verification.
+//
+// Only what the signatures cover is authenticated. For orders that's every
+// param of the order: tokens, amounts, expires, nonce and user, and the hash.
+// For trades it's the order hash, Amount, User and Nonce only, the taker
+// signs nothing else, and the trade's User must be its Buy or Sell. Price,
+// TokenBuy, TokenSell, AmountBuy, AmountSell, the counterparty and the fees
+// of a trade are not authenticated in any mode.
+//
+// Cancels are never verified, see VerifyPushCancel.
+type VerifyMode int
+
+// Verify modes
+const (
+	// VerifyOff passes events along unchecked
+	VerifyOff VerifyMode = iota
+	// VerifyMark passes every event along, setting VerifyError on failures
+	VerifyMark
+	// VerifyDrop discards events that fail verification
+	VerifyDrop
+)
+
+// VerifyOrderInserted recomputes the order's hash for the contract and checks
+// it was signed by the order's user
+func VerifyOrderInserted(o *OrderInserted, contract string) error {
+	hash, err := orderHash(contract, &Params{
+		TokenBuy:   o.TokenBuy,
+		AmountBuy:  o.AmountBuy,
+		TokenSell:  o.TokenSell,
+		AmountSell: o.AmountSell,
+		Expires:    o.Expires,
+		Nonce:      o.Nonce,
+		User:       o.User,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if o.Hash != "" && !strings.EqualFold(o.Hash, fmt.Sprintf("0x%x", hash)) {
+		return fmt.Errorf("%w: order hash %v doesn't match its params", ErrBadSignature, o.Hash)
+	}
+
+	return checkSigner(hash, o.User, &Signature{V: o.V, R: o.R, S: o.S})
+}
+
+// VerifyTradeInserted recomputes the hash of the trade, from the order hash,
+// amount, user and nonce, and checks it was signed by the trade's user, who
+// must be one of its two sides. The trade's other fields aren't signed, so
+// they aren't authenticated.
+func VerifyTradeInserted(t *TradeInserted) error {
+	if (t.Buy != "" || t.Sell != "") && !strings.EqualFold(t.User, t.Buy) && !strings.EqualFold(t.User, t.Sell) {
+		return fmt.Errorf("%w: trade user %v is neither its buyer nor seller", ErrBadSignature, t.User)
+	}
+
+	h, err := packBytes32(t.Hash)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	amount, err := packDecimal(t.Amount)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	user, err := packAddress(t.User)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	nonce, err := packUint256(big.NewInt(int64(t.Nonce)))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+
+	return checkSigner(soliditySHA3(h, amount, user, nonce), t.User, &Signature{V: t.V, R: t.R, S: t.S})
+}
+
+// VerifyPushCancel checks the cancel of the order hash with nonce was signed
+// by its user. Cancel events don't carry the nonce, so Monitor can't verify
+// them itself, but the user's own cancels can be checked.
+func VerifyPushCancel(c *PushCancel, nonce int) error {
+	h, err := packBytes32(c.Hash)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	n, err := packUint256(big.NewInt(int64(nonce)))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	return checkSigner(soliditySHA3(h, n), c.User, &Signature{V: c.V, R: c.R, S: c.S})
+}
+
+// checkSigner of hash is user
+func checkSigner(hash []byte, user string, sig *Signature) error {
+	if user == "" || sig.R == "" || sig.S == "" {
+		return fmt.Errorf("%w: event is not signed", ErrBadSignature)
+	}
+
+	signer, err := recoverSigner(hash, sig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if !strings.EqualFold(signer, user) {
+		return fmt.Errorf("%w: signed by %v, not %v", ErrBadSignature, signer, user)
+	}
+	return nil
+}
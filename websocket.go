@@ -2,9 +2,15 @@ package idex
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -13,11 +19,113 @@ import (
 type Socket struct {
 	Conn *websocket.Conn
 	URL  string
+	// Verify signatures of order and trade events, off by default. Only the
+	// fields the signatures cover are authenticated, which for trades leaves
+	// out price, tokens, amounts other than Amount, counterparty and fees, see
+	// VerifyMode. Cancels pass through unverified in every mode.
+	Verify VerifyMode
+	// ContractAddress orders are verified against, DefaultContractAddress when empty
+	ContractAddress string
+	// Reconnect paces reconnecting after the connection drops,
+	// DefaultReconnectPolicy is used when nil
+	Reconnect *ReconnectPolicy
+	// Key is the API key sent in the handshake, DefaultSocketKey when empty
+	Key string
+	// Version of the protocol asked for in the handshake, DefaultSocketVersion when empty
+	Version string
+	// Dialer sets proxy, TLS and handshake timeout, websocket.DefaultDialer when nil
+	Dialer *websocket.Dialer
+	// Header is sent with the opening HTTP request
+	Header http.Header
+	// Filter passes on only the trades, orders and cancels it matches. It's
+	// read when monitoring starts and must not change while monitoring.
+	Filter *Filter
+	// Markets resolves the tokens of events for Filter, New shares the API's
+	Markets *MarketResolver
+
+	mu     sync.Mutex
+	closed bool
+
+	// filter compiled from Filter when monitoring starts
+	filter *filter
+
+	// latest pushed values, see EthPrice, ServerBlock and RewardPoolSize
+	stateMu        sync.RWMutex
+	ethPrice       Decimal
+	serverBlock    int64
+	rewardPoolSize Decimal
+}
+
+// EthPrice is the latest price of ether in USD pushed by the server, unset
+// until the first pushEthPrice
+func (s *Socket) EthPrice() Decimal {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+	return s.ethPrice
+}
+
+// ServerBlock is the latest block the server pushed it processed, 0 until the
+// first pushServerBlock
+func (s *Socket) ServerBlock() int64 {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+	return s.serverBlock
+}
+
+// RewardPoolSize is the latest reward pool size pushed by the server, unset
+// until the first pushRewardPoolSize
+func (s *Socket) RewardPoolSize() Decimal {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+	return s.rewardPoolSize
+}
+
+// Handshake defaults, the key is the one IDEX's own web client uses
+const (
+	DefaultSocketKey     = "17paIsICur8sA0OBqG6dH5G1rmrHNMwt4oNk4iX9"
+	DefaultSocketVersion = "2.0"
+)
+
+// ReconnectPolicy paces reconnecting the websocket after its connection drops
+type ReconnectPolicy struct {
+	// MaxAttempts at reconnecting in a row before giving up, 0 never gives up
+	MaxAttempts int
+	// BaseDelay before the first attempt, doubled for each following one
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff
+	MaxDelay time.Duration
+}
+
+// DefaultReconnectPolicy reconnects forever, backing off from 1s to 30s
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		BaseDelay: time.Second,
+		MaxDelay:  30 * time.Second,
+	}
 }
 
 // Connect to websocket
 func (s *Socket) Connect() error {
-	c, resp, err := websocket.DefaultDialer.Dial(s.URL, nil)
+	return s.ConnectContext(context.Background())
+}
+
+// ConnectContext is like Connect but uses ctx for dialing
+func (s *Socket) ConnectContext(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = false
+	s.mu.Unlock()
+
+	return s.connect(ctx)
+}
+
+// connect dials and handshakes, replacing any previous connection
+func (s *Socket) connect(ctx context.Context) error {
+	d := s.Dialer
+	if d == nil {
+		d = websocket.DefaultDialer
+	}
+
+	c, resp, err := d.DialContext(ctx, s.URL, s.Header)
 	if err == websocket.ErrBadHandshake {
 		buf := new(bytes.Buffer)
 		buf.ReadFrom(resp.Body)
@@ -26,12 +134,51 @@ func (s *Socket) Connect() error {
 	if err != nil {
 		return err
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.Close()
+		return errSocketClosed
+	}
+	if s.Conn != nil {
+		s.Conn.Close()
+	}
 	s.Conn = c
 
 	return handshake(s)
 }
 
-// Handshake with server to be done immediately after connecting
+// errSocketClosed is returned when connecting a socket closed meanwhile
+var errSocketClosed = errors.New("socket closed")
+
+// closeTimeout is how long Close waits for the server to answer its close frame
+const closeTimeout = 5 * time.Second
+
+// Close the connection with a close frame. Monitor returns once the server
+// closes its side, or after a few seconds, instead of reconnecting.
+func (s *Socket) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.Conn == nil {
+		return nil
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	err := s.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	// unblock the read of a server that won't answer
+	s.Conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	return err
+}
+
+func (s *Socket) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Handshake with server to be done immediately after connecting, s.mu must be held
 func handshake(s *Socket) error {
 	type Payload struct {
 		Type    string `json:"type"`
@@ -47,10 +194,16 @@ func handshake(s *Socket) error {
 		Method: "handshake",
 		Payload: &Payload{
 			Type:    "client",
-			Version: "2.0",
-			Key:     "17paIsICur8sA0OBqG6dH5G1rmrHNMwt4oNk4iX9",
+			Version: s.Version,
+			Key:     s.Key,
 		},
 	}
+	if hs.Payload.Version == "" {
+		hs.Payload.Version = DefaultSocketVersion
+	}
+	if hs.Payload.Key == "" {
+		hs.Payload.Key = DefaultSocketKey
+	}
 	h, err := json.Marshal(hs)
 	if err != nil {
 		return err
@@ -63,103 +216,431 @@ func handshake(s *Socket) error {
 	return nil
 }
 
-// Monitor the websocket for messages
+// HandshakeResult is the server's reply to the handshake
+type HandshakeResult struct {
+	// Result is "success" when the handshake was accepted
+	Result string
+	// Type and Version the server speaks
+	Type    string
+	Version string
+	// Message explains a rejection
+	Message string
+}
+
+// Rejected is true unless the server accepted the handshake. A "success"
+// result is always an acceptance, a reply without a result is one unless it
+// carries an error message.
+func (h *HandshakeResult) Rejected() bool {
+	if h.Result == "success" {
+		return false
+	}
+	return h.Result != "" || h.Message != ""
+}
+
+// parseHandshake reads the server's handshake reply, which carries its type
+// and version in the payload, as an object or a JSON encoded string, or a
+// string payload explaining a rejection
+func parseHandshake(msg []byte) (*HandshakeResult, error) {
+	p := &struct {
+		Result  string          `json:"result"`
+		Message string          `json:"message"`
+		Error   string          `json:"error"`
+		Payload json.RawMessage `json:"payload"`
+	}{}
+	if err := json.Unmarshal(msg, p); err != nil {
+		return nil, unmarshalError(err, msg)
+	}
+
+	h := &HandshakeResult{Result: p.Result, Message: p.Message}
+	if p.Error != "" {
+		h.Message = p.Error
+	}
+
+	payload := bytes.TrimSpace(p.Payload)
+	if len(payload) > 0 && payload[0] == '"' {
+		var str string
+		if err := json.Unmarshal(payload, &str); err != nil {
+			return nil, unmarshalError(err, msg)
+		}
+		if trimmed := strings.TrimSpace(str); strings.HasPrefix(trimmed, "{") {
+			payload = []byte(trimmed)
+		} else {
+			// only a reason when the handshake failed
+			if h.Message == "" && h.Result != "success" {
+				h.Message = str
+			}
+			payload = nil
+		}
+	}
+	if len(payload) > 0 && payload[0] == '{' {
+		sp := &struct {
+			Type    string `json:"type"`
+			Version string `json:"version"`
+		}{}
+		if err := json.Unmarshal(payload, sp); err != nil {
+			return nil, unmarshalError(err, msg)
+		}
+		h.Type, h.Version = sp.Type, sp.Version
+	}
+
+	return h, nil
+}
+
+// ConnectionState of a ConnectionEvent
+type ConnectionState int
+
+// Connection states
+const (
+	// Disconnected is sent when the connection drops, Err says why
+	Disconnected ConnectionState = iota
+	// ReconnectFailed is sent for each failed attempt to reconnect
+	ReconnectFailed
+	// Reconnected is sent once the connection is back and handshaken, events
+	// sent while it was down are lost
+	Reconnected
+)
+
+func (c ConnectionState) String() string {
+	switch c {
+	case Disconnected:
+		return "disconnected"
+	case ReconnectFailed:
+		return "reconnect failed"
+	case Reconnected:
+		return "reconnected"
+	}
+	return fmt.Sprintf("ConnectionState(%d)", int(c))
+}
+
+// ConnectionEvent reports the websocket connection dropping and coming back
+type ConnectionEvent struct {
+	State ConnectionState
+	// Attempt at reconnecting, starting at 1, 0 for Disconnected
+	Attempt int
+	Err     error
+}
+
+// Monitor the websocket for messages. When the connection drops it
+// reconnects as paced by Reconnect, sending ConnectionEvents along the way.
+// It returns after Close, when it gives up reconnecting or when the server
+// rejects the handshake.
 func (s *Socket) Monitor(resp chan SocketResponse) {
+	s.MonitorContext(context.Background(), resp)
+}
+
+// MonitorContext is like Monitor but also stops when ctx is done, closing the
+// connection cleanly as Close does. It closes resp and the connection before
+// returning ctx's error, the error it gave up reconnecting with, an error
+// wrapping ErrHandshakeRejected, an invalid Filter's error, or nil after Close.
+func (s *Socket) MonitorContext(ctx context.Context, resp chan SocketResponse) error {
+	defer close(resp)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-stop:
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+
+		s.mu.Lock()
+		if s.Conn != nil {
+			s.Conn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	s.filter = nil
+	if s.Filter != nil {
+		f, err := compileFilter(s.Filter)
+		if err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
+		s.filter = f
+	}
+
 	for {
-		sr := SocketResponse{}
+		s.mu.Lock()
+		conn := s.Conn
+		s.mu.Unlock()
 
-		_, msg, err := s.Conn.ReadMessage()
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
-			sr.Error = err
-			resp <- sr
+			// read errors are permanent, the connection is of no more use
+			if s.isClosed() {
+				return ctx.Err()
+			}
+			s.sendRaw(ctx, resp, SocketResponse{Connection: &ConnectionEvent{State: Disconnected, Err: err}})
+			if err := s.reconnect(ctx, resp); err != nil {
+				return err
+			}
 			continue
 		}
 
+		sr := SocketResponse{}
 		m := &Method{}
 		if err := json.Unmarshal(msg, m); err != nil {
 			sr.Error = err
-			resp <- sr
+			s.sendRaw(ctx, resp, sr)
 			continue
 		}
 
 		switch m.Method {
 		case "handshake":
-			log.Println("Handshake successful")
+			h, err := parseHandshake(msg)
+			if err != nil {
+				s.sendRaw(ctx, resp, SocketResponse{Error: err})
+				continue
+			}
+			if h.Rejected() {
+				// the server won't take the same handshake on reconnecting either
+				err := fmt.Errorf("%w: %v", ErrHandshakeRejected, h.Message)
+				s.sendRaw(ctx, resp, SocketResponse{Handshake: h, Error: err})
+				return err
+			}
+			s.sendRaw(ctx, resp, SocketResponse{Handshake: h})
 		case "notifyTradesInserted":
-			processTradesInserted(msg, resp)
+			s.processTradesInserted(ctx, msg, resp)
 		case "notifyOrderInserted":
-			processOrderInserted(msg, resp)
+			s.processOrderInserted(ctx, msg, resp)
 		case "pushCancel":
-			processPushCancel(msg, resp)
+			s.processPushCancel(ctx, msg, resp)
 		case "pushCancels":
-			processPushCancels(msg, resp)
+			s.processPushCancels(ctx, msg, resp)
 		case "pushEthPrice":
+			s.processEthPrice(ctx, msg, resp)
 		case "pushServerBlock":
+			s.processServerBlock(ctx, msg, resp)
 		case "pushRewardPoolSize":
+			s.processRewardPoolSize(ctx, msg, resp)
 		default:
 			log.Printf("Other method: %+v\n", string(msg))
 		}
 	}
 }
 
-func processTradesInserted(msg []byte, c chan SocketResponse) {
+// reconnect until it works, returning an error when the socket is closed,
+// ctx is done or Reconnect gives up
+func (s *Socket) reconnect(ctx context.Context, resp chan SocketResponse) error {
+	p := s.Reconnect
+	if p == nil {
+		p = DefaultReconnectPolicy()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := sleep(ctx, backoff(p.BaseDelay, p.MaxDelay, attempt)); err != nil {
+			return err
+		}
+		if s.isClosed() {
+			return ctx.Err()
+		}
+
+		err := s.connect(ctx)
+		if err == nil {
+			s.sendRaw(ctx, resp, SocketResponse{Connection: &ConnectionEvent{State: Reconnected, Attempt: attempt}})
+			return nil
+		}
+		if s.isClosed() || ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.sendRaw(ctx, resp, SocketResponse{Connection: &ConnectionEvent{State: ReconnectFailed, Attempt: attempt, Err: err}})
+
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			err = fmt.Errorf("gave up reconnecting after %d attempts: %w", attempt, err)
+			s.sendRaw(ctx, resp, SocketResponse{Error: err})
+			return err
+		}
+	}
+}
+
+// unmarshalError for an event of msg that couldn't be decoded
+func unmarshalError(err error, msg []byte) error {
+	return fmt.Errorf("unmarshal error: %v, for message %v", err, string(msg))
+}
+
+func (s *Socket) processTradesInserted(ctx context.Context, msg []byte, c chan SocketResponse) {
 	p := &struct {
-		Payload []*TradeInserted `json:"payload"`
+		Payload []json.RawMessage `json:"payload"`
 	}{}
-	sr := SocketResponse{}
 
 	if err := json.Unmarshal(msg, p); err != nil {
-		sr.Error = fmt.Errorf("unmarshal error: %v, for message %v", err, string(msg))
-		c <- sr
-	} else {
-		for _, t := range p.Payload {
-			sr.TradeInserted = t
-			c <- sr
+		s.send(ctx, c, SocketResponse{Error: unmarshalError(err, msg)})
+		return
+	}
+	for _, raw := range p.Payload {
+		if !s.keep(ctx, raw, true, c) {
+			continue
 		}
+		sr := SocketResponse{TradeInserted: &TradeInserted{}}
+		if err := json.Unmarshal(raw, sr.TradeInserted); err != nil {
+			sr = SocketResponse{Error: unmarshalError(err, msg)}
+		}
+		s.send(ctx, c, sr)
 	}
 }
 
-func processOrderInserted(msg []byte, c chan SocketResponse) {
+func (s *Socket) processOrderInserted(ctx context.Context, msg []byte, c chan SocketResponse) {
 	p := &struct {
-		Payload *OrderInserted `json:"payload"`
+		Payload json.RawMessage `json:"payload"`
+	}{}
+
+	if err := json.Unmarshal(msg, p); err != nil {
+		s.send(ctx, c, SocketResponse{Error: unmarshalError(err, msg)})
+		return
+	}
+	if !s.keep(ctx, p.Payload, true, c) {
+		return
+	}
+	sr := SocketResponse{OrderInserted: &OrderInserted{}}
+	if err := json.Unmarshal(p.Payload, sr.OrderInserted); err != nil {
+		sr = SocketResponse{Error: unmarshalError(err, msg)}
+	}
+	s.send(ctx, c, sr)
+}
+
+func (s *Socket) processPushCancel(ctx context.Context, msg []byte, c chan SocketResponse) {
+	p := &struct {
+		Payload json.RawMessage `json:"payload"`
 	}{}
-	sr := SocketResponse{}
 
 	if err := json.Unmarshal(msg, p); err != nil {
-		sr.Error = fmt.Errorf("unmarshal error: %v, for message %v", err, string(msg))
+		s.send(ctx, c, SocketResponse{Error: unmarshalError(err, msg)})
+		return
+	}
+	if !s.keep(ctx, p.Payload, false, c) {
+		return
+	}
+	sr := SocketResponse{PushCancel: &PushCancel{}}
+	if err := json.Unmarshal(p.Payload, sr.PushCancel); err != nil {
+		sr = SocketResponse{Error: unmarshalError(err, msg)}
+	}
+	s.send(ctx, c, sr)
+}
+
+func (s *Socket) processPushCancels(ctx context.Context, msg []byte, c chan SocketResponse) {
+	p := &struct {
+		Payload []json.RawMessage `json:"payload"`
+	}{}
+
+	if err := json.Unmarshal(msg, p); err != nil {
+		s.send(ctx, c, SocketResponse{Error: unmarshalError(err, msg)})
+		return
+	}
+	for _, raw := range p.Payload {
+		if !s.keep(ctx, raw, false, c) {
+			continue
+		}
+		sr := SocketResponse{PushCancel: &PushCancel{}}
+		if err := json.Unmarshal(raw, sr.PushCancel); err != nil {
+			sr = SocketResponse{Error: unmarshalError(err, msg)}
+		}
+		s.send(ctx, c, sr)
+	}
+}
+
+func (s *Socket) processEthPrice(ctx context.Context, msg []byte, c chan SocketResponse) {
+	p := &struct {
+		Payload *EthPrice `json:"payload"`
+	}{}
+	sr := SocketResponse{}
+
+	err := json.Unmarshal(msg, p)
+	if err == nil && p.Payload == nil {
+		err = errors.New("no payload")
+	}
+	if err != nil {
+		sr.Error = unmarshalError(err, msg)
 	} else {
-		sr.OrderInserted = p.Payload
+		s.stateMu.Lock()
+		s.ethPrice = p.Payload.USD
+		s.stateMu.Unlock()
+		sr.EthPrice = p.Payload
 	}
-	c <- sr
+	s.send(ctx, c, sr)
 }
 
-func processPushCancel(msg []byte, c chan SocketResponse) {
+func (s *Socket) processServerBlock(ctx context.Context, msg []byte, c chan SocketResponse) {
 	p := &struct {
-		Payload *PushCancel `json:"payload"`
+		Payload *ServerBlock `json:"payload"`
 	}{}
 	sr := SocketResponse{}
 
-	if err := json.Unmarshal(msg, p); err != nil {
-		sr.Error = fmt.Errorf("unmarshal error: %v, for message %v", err, string(msg))
+	err := json.Unmarshal(msg, p)
+	if err == nil && p.Payload == nil {
+		err = errors.New("no payload")
+	}
+	if err != nil {
+		sr.Error = unmarshalError(err, msg)
 	} else {
-		sr.PushCancel = p.Payload
+		s.stateMu.Lock()
+		// blocks only move forward, ignore a late push from a lagging server
+		if p.Payload.Number > s.serverBlock {
+			s.serverBlock = p.Payload.Number
+		}
+		s.stateMu.Unlock()
+		sr.ServerBlock = p.Payload
 	}
-	c <- sr
+	s.send(ctx, c, sr)
 }
 
-func processPushCancels(msg []byte, c chan SocketResponse) {
+func (s *Socket) processRewardPoolSize(ctx context.Context, msg []byte, c chan SocketResponse) {
 	p := &struct {
-		Payload []*PushCancel `json:"payload"`
+		Payload *RewardPoolSize `json:"payload"`
 	}{}
 	sr := SocketResponse{}
 
-	if err := json.Unmarshal(msg, p); err != nil {
-		sr.Error = fmt.Errorf("unmarshal error: %v, for message %v", err, string(msg))
-		c <- sr
+	err := json.Unmarshal(msg, p)
+	if err == nil && p.Payload == nil {
+		err = errors.New("no payload")
+	}
+	if err != nil {
+		sr.Error = unmarshalError(err, msg)
 	} else {
-		for _, pc := range p.Payload {
-			sr.PushCancel = pc
-			c <- sr
+		s.stateMu.Lock()
+		s.rewardPoolSize = p.Payload.Size
+		s.stateMu.Unlock()
+		sr.RewardPoolSize = p.Payload
+	}
+	s.send(ctx, c, sr)
+}
+
+// send sr on c, verifying its event first when Verify is on
+func (s *Socket) send(ctx context.Context, c chan SocketResponse, sr SocketResponse) {
+	if s.Verify != VerifyOff && sr.Error == nil {
+		sr.VerifyError = s.verify(&sr)
+		if sr.VerifyError != nil && s.Verify == VerifyDrop {
+			return
 		}
 	}
+	s.sendRaw(ctx, c, sr)
+}
+
+// sendRaw sends sr on c unless ctx is done first, so a consumer that stopped
+// reading once it cancelled ctx doesn't block shutting down
+func (s *Socket) sendRaw(ctx context.Context, c chan SocketResponse, sr SocketResponse) {
+	select {
+	case c <- sr:
+	case <-ctx.Done():
+	}
+}
+
+func (s *Socket) verify(sr *SocketResponse) error {
+	switch {
+	case sr.OrderInserted != nil:
+		contract := s.ContractAddress
+		if contract == "" {
+			contract = DefaultContractAddress
+		}
+		return VerifyOrderInserted(sr.OrderInserted, contract)
+	case sr.TradeInserted != nil:
+		return VerifyTradeInserted(sr.TradeInserted)
+	}
+	return nil
 }